@@ -95,6 +95,8 @@ type SecretRule struct {
 	GcpSecretsManager *GcpSecretsManager `json:"gcpSecretsManager,omitempty"`
 	// AwsSecretsManager config
 	AwsSecretsManager *AwsSecretsManager `json:"secretsManager,omitempty"`
+	// Canonical pins this secret as the one to edit and populate when several secrets share the same locations in the secret store
+	Canonical bool `json:"canonical,omitempty"`
 }
 
 // BackendType describes a secrets backend
@@ -200,6 +202,17 @@ func (c *SecretMapping) FindSecret(secretName string) *SecretRule {
 	return nil
 }
 
+// IsCanonical returns true if the secret has been pinned as the canonical secret for any shared locations in the secret store
+func (c *SecretMapping) IsCanonical(namespace, secretName string) bool {
+	for i := range c.Spec.Secrets {
+		m := &c.Spec.Secrets[i]
+		if m.Name == secretName && (m.Namespace == "" || m.Namespace == namespace) && m.Canonical {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *SecretMapping) IsSecretKeyUnsecured(secretName, keyName string) bool {
 	secret := c.FindSecret(secretName)
 	if secret == nil {
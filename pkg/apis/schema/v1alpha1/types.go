@@ -4,6 +4,24 @@ import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 const (
 	LabelKind = "kind"
+
+	// KindConfirm the kind label value for a property which is a boolean confirmation
+	KindConfirm = "confirm"
+
+	// KindSelect the kind label value for a property whose value is selected from the Options
+	KindSelect = "select"
+
+	// KindMultiLine the kind label value for a property which is edited in an editor such as a certificate or JSON document
+	KindMultiLine = "multiline"
+
+	// KindText the kind label value for a property which is not secret such as a user name so the value is shown when typed
+	KindText = "text"
+
+	// KindFile the kind label value for a property whose value is read from a file
+	KindFile = "file"
+
+	// KindPassword the kind label value for a property which is a secret value which is hidden when typed. This is the default
+	KindPassword = "password"
 )
 
 // +genclient
@@ -89,13 +107,18 @@ type Property struct {
 	// DefaultValue is used to specify default values populated on startup
 	DefaultValue string `json:"defaultValue,omitempty" yaml:"defaultValue,omitempty"`
 
+	// Options the values to choose from for properties of kind select
+	Options []string `json:"options,omitempty" yaml:"options,omitempty"`
+
 	// Pattern is a regular expression pattern used for validation
 	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
 
-	// Requires specifies a requirements expression
+	// Requires specifies a requirements expression which must be true for the property to be required
+	// such as `cluster.provider == "gke"` or `properties.username != ""` to use the value of another property
 	Requires string `json:"requires,omitempty" yaml:"requires,omitempty"`
 
-	// Format the format of the value
+	// Format the format of the value which is validated if it is one of: url, email, json, yaml, pem-certificate,
+	// pem-private-key, dockerconfigjson, htpasswd, ssh-private-key, jwt or base64
 	Format string `json:"format,omitempty" yaml:"format,omitempty"`
 
 	// Generator the name of the generator to use to create values
@@ -0,0 +1,119 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHashValue(t *testing.T) {
+	assert.Equal(t, "", audit.HashValue("", []byte("my-key")), "blank value")
+	assert.Equal(t, "", audit.HashValue("s3cret", nil), "should not hash without a key")
+
+	hmac := audit.HashValue("s3cret", []byte("my-key"))
+	assert.True(t, strings.HasPrefix(hmac, "hmac-sha256:"), "hmac %s", hmac)
+	assert.NotContains(t, hmac, "s3cret", "hmac")
+	assert.Equal(t, hmac, audit.HashValue("s3cret", []byte("my-key")), "hmac should be stable")
+	assert.NotEqual(t, hmac, audit.HashValue("s3cret", []byte("another-key")), "hmac should depend on the key")
+}
+
+func TestAuditor(t *testing.T) {
+	var auditor *audit.Auditor
+	err := auditor.Record(&audit.Event{Key: "secret/data/jx/adminUser", Properties: []audit.Property{{Name: "password"}}})
+	require.NoError(t, err, "a nil auditor should not fail")
+
+	o := &audit.Options{}
+	auditor, err = o.NewAuditor("populate", nil)
+	require.NoError(t, err, "failed to create auditor")
+	assert.Nil(t, auditor, "should not create an auditor without sinks")
+
+	auditFile := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	buf := &bytes.Buffer{}
+	kubeClient := fake.NewSimpleClientset()
+	o = &audit.Options{
+		File:    auditFile,
+		Events:  true,
+		User:    "test-user",
+		HashKey: "my-key",
+		Sinks:   []audit.Sink{&audit.WriterSink{Out: buf}},
+	}
+	auditor, err = o.NewAuditor("populate", kubeClient)
+	require.NoError(t, err, "failed to create auditor")
+	require.NotNil(t, auditor, "should have created an auditor")
+
+	for i := 0; i < 2; i++ {
+		err = auditor.Record(&audit.Event{
+			Timestamp:      time.Date(2024, 1, 2, 3, 4, 5, i, time.UTC),
+			Namespace:      "jx",
+			ExternalSecret: "jx-admin-user",
+			Backend:        "vault",
+			Key:            "secret/data/jx/adminUser",
+			Properties: []audit.Property{
+				auditor.Property("password", "s3cret", audit.SourceGenerator),
+			},
+		})
+		require.NoError(t, err, "failed to record event")
+	}
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err, "failed to read %s", auditFile)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2, "audit log lines")
+	assert.Equal(t, string(data), buf.String(), "the writer sink should have the same lines")
+	assert.NotContains(t, string(data), "s3cret", "the audit log should not contain the value")
+
+	e := &audit.Event{}
+	err = json.Unmarshal([]byte(lines[0]), e)
+	require.NoError(t, err, "failed to parse %s", lines[0])
+	assert.Equal(t, "test-user", e.User, "user")
+	assert.Equal(t, "jx-secret populate", e.Command, "command")
+	assert.Equal(t, []string{"password"}, e.PropertyNames(), "properties")
+	assert.Equal(t, audit.SourceGenerator, e.Properties[0].Source, "source")
+	assert.Equal(t, audit.HashValue("s3cret", []byte("my-key")), e.Properties[0].Hash, "hash")
+
+	events, err := kubeClient.CoreV1().Events("jx").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err, "failed to list Events")
+	require.Len(t, events.Items, 2, "Events")
+	event := events.Items[0]
+	assert.Equal(t, audit.EventReason, event.Reason, "reason")
+	assert.Equal(t, "ExternalSecret", event.InvolvedObject.Kind, "involved object kind")
+	assert.Equal(t, "jx-admin-user", event.InvolvedObject.Name, "involved object name")
+	assert.Equal(t, "test-user wrote key secret/data/jx/adminUser properties password (generator) for ExternalSecret jx/jx-admin-user", event.Message, "message")
+	assert.NotEmpty(t, event.Annotations[audit.EventAnnotation], "audit annotation")
+}
+
+func TestAuditorHashKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyFile := filepath.Join(tmpDir, "hash-key")
+	err := os.WriteFile(keyFile, []byte("my-key\n"), 0o600)
+	require.NoError(t, err, "failed to write %s", keyFile)
+
+	buf := &bytes.Buffer{}
+	o := &audit.Options{
+		HashKeyFile: keyFile,
+		Sinks:       []audit.Sink{&audit.WriterSink{Out: buf}},
+	}
+	auditor, err := o.NewAuditor("edit", nil)
+	require.NoError(t, err, "failed to create auditor")
+	assert.Equal(t, audit.HashValue("s3cret", []byte("my-key")), auditor.Property("password", "s3cret", audit.SourceUser).Hash, "hash")
+
+	o.HashKeyFile = ""
+	auditor, err = o.NewAuditor("edit", nil)
+	require.NoError(t, err, "failed to create auditor")
+	assert.Empty(t, auditor.Property("password", "s3cret", audit.SourceUser).Hash, "should not record a hash without a key")
+
+	o.HashKeyFile = filepath.Join(tmpDir, "missing")
+	_, err = o.NewAuditor("edit", nil)
+	require.Error(t, err, "should fail for a missing hash key file")
+}
@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// EnvLogFile the environment variable for the default audit log file
+	EnvLogFile = "JX_SECRET_AUDIT_LOG"
+
+	// EnvHashKey the environment variable for the key used to HMAC the value hashes
+	EnvHashKey = "JX_SECRET_AUDIT_HASH_KEY"
+
+	// EnvHashKeyFile the environment variable for the default file containing the key used to HMAC the value hashes
+	EnvHashKeyFile = "JX_SECRET_AUDIT_HASH_KEY_FILE"
+)
+
+// Options the options for auditing writes which are added to the commands which write secrets
+type Options struct {
+	File        string
+	Events      bool
+	Stdout      bool
+	User        string
+	HashKey     string
+	HashKeyFile string
+
+	// Sinks any additional sinks such as for testing
+	Sinks []Sink
+}
+
+// AddFlags adds the audit flags to the command
+func (o *Options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.File, "audit-log", "", os.Getenv(EnvLogFile), "the file to append a JSON line to for each secret write. Defaults to $"+EnvLogFile)
+	cmd.Flags().BoolVarP(&o.Events, "audit-events", "", false, "creates a Kubernetes Event on the ExternalSecret for each secret write")
+	cmd.Flags().BoolVarP(&o.Stdout, "audit-stdout", "", false, "writes a JSON line to stdout for each secret write")
+	cmd.Flags().StringVarP(&o.User, "audit-user", "", "", "the user recorded in the audit events. Defaults to the kubernetes user or service account")
+	cmd.Flags().StringVarP(&o.HashKeyFile, "audit-hash-key-file", "", os.Getenv(EnvHashKeyFile), "the file containing the key used to record an HMAC of each value written. Without a key no hashes are recorded. Defaults to $"+EnvHashKeyFile+" or the key in $"+EnvHashKey)
+}
+
+// Auditor records the audit events for writes to the configured sinks
+type Auditor struct {
+	User    string
+	Command string
+	Sinks   []Sink
+	hashKey []byte
+}
+
+// NewAuditor creates the auditor for the command. Returns nil if there are no sinks
+func (o *Options) NewAuditor(command string, kubeClient kubernetes.Interface) (*Auditor, error) {
+	sinks := append([]Sink{}, o.Sinks...)
+	if o.File != "" {
+		sinks = append(sinks, &FileSink{Path: o.File})
+	}
+	if o.Stdout {
+		sinks = append(sinks, &WriterSink{Out: os.Stdout})
+	}
+	if o.Events {
+		if kubeClient == nil {
+			log.Logger().Warnf("cannot create audit Events without a kubernetes client")
+		} else {
+			sinks = append(sinks, &EventSink{KubeClient: kubeClient})
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	hashKey, err := o.hashKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(hashKey) == 0 {
+		log.Logger().Debugf("no audit hash key so the hashes of the values are not recorded")
+	}
+	userName := o.User
+	if userName == "" {
+		userName = CurrentUser(kubeClient)
+	}
+	return &Auditor{
+		User:    userName,
+		Command: rootcmd.BinaryName + " " + command,
+		Sinks:   sinks,
+		hashKey: hashKey,
+	}, nil
+}
+
+// hashKey returns the key used to HMAC the values from the hash key file or the hash key
+func (o *Options) hashKey() ([]byte, error) {
+	if o.HashKeyFile != "" {
+		data, err := os.ReadFile(o.HashKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read audit hash key file %s", o.HashKeyFile)
+		}
+		key := bytes.TrimSpace(data)
+		if len(key) == 0 {
+			return nil, errors.Errorf("audit hash key file %s is empty", o.HashKeyFile)
+		}
+		return key, nil
+	}
+	hashKey := o.HashKey
+	if hashKey == "" {
+		hashKey = os.Getenv(EnvHashKey)
+	}
+	return []byte(hashKey), nil
+}
+
+// Property creates the audit of a written property hashing its value
+func (a *Auditor) Property(name, value string, source Source) Property {
+	var hashKey []byte
+	if a != nil {
+		hashKey = a.hashKey
+	}
+	return Property{
+		Name:   name,
+		Source: source,
+		Hash:   HashValue(value, hashKey),
+	}
+}
+
+// Record records the event in all of the sinks. It is a no op on a nil auditor
+func (a *Auditor) Record(e *Event) error {
+	if a == nil || len(e.Properties) == 0 {
+		return nil
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	if e.User == "" {
+		e.User = a.User
+	}
+	if e.Command == "" {
+		e.Command = a.Command
+	}
+	var failed []error
+	for _, s := range a.Sinks {
+		err := s.Write(e)
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 1 {
+		return errors.Wrapf(failed[0], "failed to record audit event for key %s", e.Key)
+	}
+	if len(failed) > 1 {
+		return errors.Errorf("failed to record audit event for key %s in %d sinks: %s", e.Key, len(failed), failed[0].Error())
+	}
+	return nil
+}
+
+// CurrentUser returns the kubernetes user or service account if it can be found otherwise the local user
+func CurrentUser(kubeClient kubernetes.Interface) string {
+	if kubeClient != nil {
+		review, err := kubeClient.AuthenticationV1().SelfSubjectReviews().Create(context.TODO(), &authv1.SelfSubjectReview{}, metav1.CreateOptions{})
+		if err != nil {
+			log.Logger().Debugf("failed to find the kubernetes user: %s", err.Error())
+		} else if review != nil && review.Status.UserInfo.Username != "" {
+			return review.Status.UserInfo.Username
+		}
+	}
+	u, err := user.Current()
+	if err == nil && u.Username != "" {
+		return u.Username
+	}
+	return ""
+}
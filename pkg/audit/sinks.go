@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// EventReason the reason of the Kubernetes Events created for writes
+	EventReason = "SecretWritten"
+
+	// EventAnnotation the annotation on the Kubernetes Events which contains the JSON encoded audit event
+	EventAnnotation = "secret.jenkins-x.io/audit"
+)
+
+// Sink records audit events
+type Sink interface {
+	Write(e *Event) error
+}
+
+// FileSink appends the events as JSON lines to a file
+type FileSink struct {
+	Path string
+}
+
+// Write appends the event to the file
+func (s *FileSink) Write(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit event")
+	}
+	err = os.MkdirAll(filepath.Dir(s.Path), 0o700)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the directory for audit log %s", s.Path)
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open audit log %s", s.Path)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "failed to write audit log %s", s.Path)
+	}
+	return f.Close()
+}
+
+// WriterSink writes the events as JSON lines to a writer such as stdout
+type WriterSink struct {
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+// Write writes the event to the writer
+func (s *WriterSink) Write(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit event")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.Out.Write(append(data, '\n'))
+	return err
+}
+
+// EventSink creates a Kubernetes Event on the ExternalSecret for each write
+type EventSink struct {
+	KubeClient kubernetes.Interface
+}
+
+// Write creates the Kubernetes Event
+func (s *EventSink) Write(e *Event) error {
+	if e.Namespace == "" {
+		return errors.Errorf("cannot create an Event for ExternalSecret %s without a namespace", e.ExternalSecret)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit event")
+	}
+	now := metav1.NewTime(e.Timestamp)
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", e.ExternalSecret, e.Timestamp.UnixNano()),
+			Namespace: e.Namespace,
+			Annotations: map[string]string{
+				EventAnnotation: string(data),
+			},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "kubernetes-client.io/v1",
+			Kind:       "ExternalSecret",
+			Name:       e.ExternalSecret,
+			Namespace:  e.Namespace,
+		},
+		Reason:              EventReason,
+		Message:             e.String(),
+		Type:                corev1.EventTypeNormal,
+		Source:              corev1.EventSource{Component: rootcmd.BinaryName},
+		ReportingController: rootcmd.BinaryName,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	_, err = s.KubeClient.CoreV1().Events(e.Namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create Event for ExternalSecret %s in namespace %s", e.ExternalSecret, e.Namespace)
+	}
+	return nil
+}
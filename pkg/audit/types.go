@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Source describes where a written value came from
+type Source string
+
+const (
+	// SourceGenerator the value was created by a generator in the schema
+	SourceGenerator Source = "generator"
+
+	// SourceTemplate the value was created by a template in the schema
+	SourceTemplate Source = "template"
+
+	// SourceDefault the value is the default value in the schema
+	SourceDefault Source = "default"
+
+	// SourceHelm the value is the default value from the helm secrets
+	SourceHelm Source = "helm"
+
+	// SourceUser the value was entered by the user
+	SourceUser Source = "user"
+
+	// SourceLiteral the value was specified via the --from-literal flag
+	SourceLiteral Source = "literal"
+
+	// SourceFile the value was read from a file via the --from-file flag
+	SourceFile Source = "file"
+
+	// SourceRestore the value was restored from a backup archive
+	SourceRestore Source = "restore"
+
+	// SourceCurrent the value is unchanged and was written again with the other properties
+	SourceCurrent Source = "current"
+)
+
+// Event the audit event for a write of a key in a secret store
+type Event struct {
+	Timestamp      time.Time  `json:"timestamp"`
+	User           string     `json:"user,omitempty"`
+	Command        string     `json:"command,omitempty"`
+	Namespace      string     `json:"namespace,omitempty"`
+	ExternalSecret string     `json:"externalSecret"`
+	Backend        string     `json:"backend"`
+	Location       string     `json:"location,omitempty"`
+	Key            string     `json:"key"`
+	Properties     []Property `json:"properties"`
+}
+
+// Property the audit of a property which was written. The value itself is never recorded and
+// the hash of the value is only recorded if there is a hash key
+type Property struct {
+	Name   string `json:"name"`
+	Source Source `json:"source"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// PropertyNames returns the names of the properties
+func (e *Event) PropertyNames() []string {
+	var answer []string
+	for _, p := range e.Properties {
+		answer = append(answer, p.Name)
+	}
+	return answer
+}
+
+// String returns a summary of the event without the value hashes
+func (e *Event) String() string {
+	var properties []string
+	for _, p := range e.Properties {
+		properties = append(properties, p.Name+" ("+string(p.Source)+")")
+	}
+	user := e.User
+	if user == "" {
+		user = "unknown"
+	}
+	return user + " wrote key " + e.Key + " properties " + strings.Join(properties, ", ") + " for ExternalSecret " + e.Namespace + "/" + e.ExternalSecret
+}
+
+// HashValue returns the HMAC of a value so that writes can be compared without recording the value.
+//
+// Returns a blank string if there is no hash key as a plain hash of a low entropy value like a password could be guessed
+func HashValue(value string, hashKey []byte) string {
+	if value == "" || len(hashKey) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write([]byte(value))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,77 @@
+package backups
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ArchiveVersion the current version of the archive format
+const ArchiveVersion = 1
+
+// Archive the values behind the ExternalSecrets which is encrypted before it is written to disk
+type Archive struct {
+	// Version the version of the archive format
+	Version int `json:"version"`
+
+	// Created when the archive was created
+	Created time.Time `json:"created"`
+
+	// Entries the values
+	Entries []*Entry `json:"entries"`
+}
+
+// Entry the value of an entry of an ExternalSecret
+type Entry struct {
+	// Namespace the namespace of the ExternalSecret
+	Namespace string `json:"namespace"`
+
+	// ExternalSecret the name of the ExternalSecret
+	ExternalSecret string `json:"externalSecret"`
+
+	// Name the name of the entry in the Secret
+	Name string `json:"name"`
+
+	// BackendType the backend type the value was read from
+	BackendType string `json:"backendType"`
+
+	// Location the location in the secret store such as the vault URL or GCP project
+	Location string `json:"location,omitempty"`
+
+	// Key the key in the secret store
+	Key string `json:"key"`
+
+	// Property the property of the key in the secret store
+	Property string `json:"property,omitempty"`
+
+	// Value the secret value
+	Value string `json:"value"`
+}
+
+// SecretKey returns the namespace/name of the ExternalSecret
+func (e *Entry) SecretKey() string {
+	return e.Namespace + "/" + e.ExternalSecret
+}
+
+// ToJSON marshals the archive
+func (a *Archive) ToJSON() ([]byte, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal archive")
+	}
+	return data, nil
+}
+
+// ParseArchive parses the decrypted archive
+func ParseArchive(data []byte) (*Archive, error) {
+	a := &Archive{}
+	err := json.Unmarshal(data, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse archive")
+	}
+	if a.Version > ArchiveVersion {
+		return nil, errors.Errorf("archive version %d is newer than the supported version %d", a.Version, ArchiveVersion)
+	}
+	return a, nil
+}
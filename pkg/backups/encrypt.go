@@ -0,0 +1,157 @@
+package backups
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// EncryptionAge encrypts using the age binary
+	EncryptionAge = "age"
+
+	// EncryptionGPG encrypts using the gpg binary
+	EncryptionGPG = "gpg"
+
+	ageHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	gpgHeader = "-----BEGIN PGP MESSAGE-----"
+)
+
+// Encrypter encrypts and decrypts archives using the age or gpg binaries.
+//
+// The plain text is only ever passed via stdin and stdout so it is never written to disk or logged
+type Encrypter struct {
+	AgeRecipients []string
+	AgeIdentities []string
+	GPGRecipients []string
+	CommandRunner cmdrunner.CommandRunner
+}
+
+// AddEncryptFlags adds the flags for encrypting
+func (e *Encrypter) AddEncryptFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&e.AgeRecipients, "age-recipient", "", nil, "the age public key to encrypt the archive for")
+	cmd.Flags().StringArrayVarP(&e.GPGRecipients, "gpg-recipient", "", nil, "the GPG key ID or email to encrypt the archive for")
+}
+
+// AddDecryptFlags adds the flags for decrypting
+func (e *Encrypter) AddDecryptFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&e.AgeIdentities, "age-identity", "", nil, "the age identity file to decrypt an age archive. GPG archives are decrypted using the keys in your GPG keyring")
+}
+
+// Encryption returns the kind of encryption for the recipients
+func (e *Encrypter) Encryption() (string, error) {
+	switch {
+	case len(e.AgeRecipients) > 0 && len(e.GPGRecipients) > 0:
+		return "", errors.Errorf("cannot use both --age-recipient and --gpg-recipient")
+	case len(e.AgeRecipients) > 0:
+		return EncryptionAge, nil
+	case len(e.GPGRecipients) > 0:
+		return EncryptionGPG, nil
+	default:
+		return "", errors.Errorf("missing --age-recipient or --gpg-recipient to encrypt the archive")
+	}
+}
+
+// Encrypt encrypts the data to the given file
+func (e *Encrypter) Encrypt(data []byte, path string) error {
+	encryption, err := e.Encryption()
+	if err != nil {
+		return err
+	}
+	c := &cmdrunner.Command{
+		In: bytes.NewReader(data),
+	}
+	if encryption == EncryptionAge {
+		c.Name = "age"
+		c.Args = []string{"--encrypt", "--armor", "--output", path}
+		for _, r := range e.AgeRecipients {
+			c.Args = append(c.Args, "--recipient", r)
+		}
+	} else {
+		c.Name = "gpg"
+		c.Args = []string{"--batch", "--yes", "--encrypt", "--armor", "--output", path}
+		for _, r := range e.GPGRecipients {
+			c.Args = append(c.Args, "--recipient", r)
+		}
+	}
+	_, err = e.runner()(c)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encrypt archive %s with %s", path, encryption)
+	}
+	return nil
+}
+
+// Decrypt decrypts the given file detecting whether it was encrypted with age or gpg
+func (e *Encrypter) Decrypt(path string) ([]byte, error) {
+	encryption, err := DetectEncryption(path)
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	c := &cmdrunner.Command{
+		Out: out,
+		Err: errOut,
+	}
+	if encryption == EncryptionAge {
+		if len(e.AgeIdentities) == 0 {
+			return nil, errors.Errorf("missing --age-identity to decrypt the age archive %s", path)
+		}
+		c.Name = "age"
+		c.Args = []string{"--decrypt"}
+		for _, i := range e.AgeIdentities {
+			c.Args = append(c.Args, "--identity", i)
+		}
+		c.Args = append(c.Args, path)
+	} else {
+		c.Name = "gpg"
+		c.Args = []string{"--quiet", "--decrypt", path}
+	}
+
+	_, err = e.runner()(c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt archive %s with %s: %s", path, encryption, strings.TrimSpace(errOut.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// runner returns the command runner. The default command runner is never used as it would log the decrypted output
+func (e *Encrypter) runner() cmdrunner.CommandRunner {
+	if e.CommandRunner == nil {
+		return cmdrunner.QuietCommandRunner
+	}
+	return e.CommandRunner
+}
+
+// DetectEncryption detects if the armored archive was encrypted with age or gpg
+func DetectEncryption(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open archive %s", path)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case ageHeader:
+			return EncryptionAge, nil
+		case gpgHeader:
+			return EncryptionGPG, nil
+		default:
+			return "", errors.Errorf("archive %s is not an armored age or GPG encrypted file", path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrapf(err, "failed to read archive %s", path)
+	}
+	return "", errors.Errorf("archive %s is empty", path)
+}
@@ -0,0 +1,65 @@
+package testbackups
+
+import (
+	"encoding/base64"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ageHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageFooter = "-----END AGE ENCRYPTED FILE-----"
+)
+
+// NewFakeAgeRunner creates a command runner which fakes the age binary by base64 encoding the data
+func NewFakeAgeRunner(t *testing.T) cmdrunner.CommandRunner {
+	return func(c *cmdrunner.Command) (string, error) {
+		require.Equal(t, "age", c.Name, "command name")
+		require.NotEmpty(t, c.Args, "command arguments")
+
+		switch c.Args[0] {
+		case "--encrypt":
+			output := argValue(c.Args, "--output")
+			require.NotEmpty(t, output, "missing --output argument")
+			require.NotEmpty(t, argValue(c.Args, "--recipient"), "missing --recipient argument")
+			require.NotNil(t, c.In, "should pass the data via stdin")
+			data, err := io.ReadAll(c.In)
+			require.NoError(t, err, "failed to read stdin")
+			text := ageHeader + "\n" + base64.StdEncoding.EncodeToString(data) + "\n" + ageFooter + "\n"
+			err = os.WriteFile(output, []byte(text), 0o600)
+			require.NoError(t, err, "failed to write %s", output)
+			return "", nil
+
+		case "--decrypt":
+			require.NotEmpty(t, argValue(c.Args, "--identity"), "missing --identity argument")
+			require.NotNil(t, c.Out, "should write the decrypted data to a writer rather than return it")
+			path := c.Args[len(c.Args)-1]
+			data, err := os.ReadFile(path)
+			require.NoError(t, err, "failed to read %s", path)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			require.Len(t, lines, 3, "lines in %s", path)
+			decoded, err := base64.StdEncoding.DecodeString(lines[1])
+			require.NoError(t, err, "failed to decode %s", path)
+			_, err = c.Out.Write(decoded)
+			return "", err
+
+		default:
+			t.Fatalf("unexpected age arguments %v", c.Args)
+			return "", nil
+		}
+	}
+}
+
+func argValue(args []string, name string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdLong = templates.LongDesc(`
+		Backs up the values in the underlying secret storage for the ExternalSecrets into an encrypted archive
+
+		The archive is encrypted with age or GPG using the age or gpg binary which must be on your PATH. The values are passed to the binary via stdin so they are never written to disk unencrypted.
+
+		Use the restore command to write the values back, optionally to a different backend type.
+`)
+
+	cmdExample = templates.Examples(`
+		# backup all the secrets encrypting them with age
+		%s backup --age-recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+
+		# backup the secrets in a namespace encrypting them with GPG
+		%s backup -n jx --gpg-recipient admin@example.com -o jx-secrets.asc
+	`)
+)
+
+// Options the options for the command
+type Options struct {
+	secretfacade.Options
+	backups.Encrypter
+
+	OutFile string
+	Archive *backups.Archive
+
+	secretManagers populate.SecretManagers
+}
+
+// NewCmdBackup creates a command object for the command
+func NewCmdBackup() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "backup",
+		Short:   "Backs up the values in the underlying secret storage for the ExternalSecrets into an encrypted archive",
+		Long:    cmdLong,
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "the namespace to filter the ExternalSecret resources")
+	cmd.Flags().StringVarP(&o.OutFile, "output", "o", "", "the archive file to write. Defaults to secrets-backup.age or secrets-backup.asc depending on the encryption")
+	o.Encrypter.AddEncryptFlags(cmd)
+	o.Options.AddFlags(cmd)
+	return cmd, o
+}
+
+// Validate validates the options
+func (o *Options) Validate() error {
+	encryption, err := o.Encryption()
+	if err != nil {
+		return err
+	}
+	if o.OutFile == "" {
+		o.OutFile = "secrets-backup.age"
+		if encryption == backups.EncryptionGPG {
+			o.OutFile = "secrets-backup.asc"
+		}
+	}
+	return o.Options.Validate()
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating options")
+	}
+
+	pairs, err := o.Load()
+	if err != nil {
+		return errors.Wrap(err, "failed to load ExternalSecret and Secret pairs")
+	}
+
+	o.Archive = &backups.Archive{
+		Version: backups.ArchiveVersion,
+		Created: time.Now().UTC(),
+	}
+	missing := 0
+	for _, r := range pairs {
+		if !o.Matches(r) {
+			continue
+		}
+		// replicas are populated from their source secret
+		if r.ExternalSecret.Annotations[extsecrets.ReplicaAnnotation] == "true" {
+			continue
+		}
+		entries, m, err := o.backupSecret(r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to backup ExternalSecret %s", r.Key())
+		}
+		o.Archive.Entries = append(o.Archive.Entries, entries...)
+		missing += m
+	}
+	if len(o.Archive.Entries) == 0 {
+		return errors.Errorf("no values found for the %d ExternalSecrets", len(pairs))
+	}
+
+	data, err := o.Archive.ToJSON()
+	if err != nil {
+		return err
+	}
+	err = o.Encrypt(data, o.OutFile)
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		log.Logger().Warnf("%d entries had no value in the secret store so were not backed up", missing)
+	}
+	log.Logger().Infof("backed up %d values to %s", len(o.Archive.Entries), termcolor.ColorInfo(o.OutFile))
+	return nil
+}
+
+// backupSecret returns the entries for the values of the secret and the number of entries without a value
+func (o *Options) backupSecret(r *secretfacade.SecretPair) ([]*backups.Entry, int, error) {
+	es := &r.ExternalSecret
+	backendType := es.Spec.BackendType
+	secretManager, err := o.getSecretManager(backendType)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to create a secret manager for backend type %s", backendType)
+	}
+	location := populate.GetExternalSecretLocation(es)
+
+	var answer []*backups.Entry
+	missing := 0
+	for i := range es.Spec.Data {
+		d := &es.Spec.Data[i]
+		key := populate.GetSecretKey(v1alpha1.BackendType(backendType), es.Name, d.Key)
+		value, err := secretManager.GetSecret(location, key, d.Property)
+		if err != nil {
+			if !editor.IsSecretNotFound(err) {
+				return nil, 0, errors.Wrapf(err, "failed to get key %s property %s from the secret store", key, d.Property)
+			}
+			log.Logger().Debugf("key %s property %s is not in the secret store: %s", key, d.Property, err.Error())
+			value = ""
+		}
+		if value == "" {
+			missing++
+			continue
+		}
+		answer = append(answer, &backups.Entry{
+			Namespace:      es.Namespace,
+			ExternalSecret: es.Name,
+			Name:           d.Name,
+			BackendType:    backendType,
+			Location:       location,
+			Key:            key,
+			Property:       d.Property,
+			Value:          value,
+		})
+	}
+	return answer, missing, nil
+}
+
+func (o *Options) getSecretManager(backendType string) (secretstore.Interface, error) {
+	return o.secretManagers.Get(o.SecretStoreManagerFactory, o.KubeClient, backendType)
+}
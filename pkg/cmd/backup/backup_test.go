@@ -0,0 +1,115 @@
+package backup_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups/testbackups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/backup"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	secretstorefake "github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBackup(t *testing.T) {
+	var err error
+	ns := "jx"
+	location := "my-project"
+
+	_, o := backup.NewCmdBackup()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	o.SecretStoreManagerFactory = fakeFactory
+	_, err = fakeFactory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	fakeStore := fakeFactory.GetSecretStore()
+	storeValues := map[string]map[string]string{
+		"jx-basic-auth": {
+			"username": "admin",
+			"password": "my-password",
+		},
+		"lighthouse-oauth-token": {
+			"token": "my-oauth-token",
+		},
+	}
+	for k, v := range storeValues {
+		err = fakeStore.SetSecret(location, k, &secretstore.SecretValue{PropertyValues: v})
+		require.NoError(t, err)
+	}
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	o.OutFile = filepath.Join(t.TempDir(), "secrets-backup.age")
+	o.AgeRecipients = []string{"age1dummy"}
+	o.Encrypter.CommandRunner = testbackups.NewFakeAgeRunner(t)
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run backup")
+
+	require.NotNil(t, o.Archive, "no archive created")
+	values := map[string]string{}
+	for _, e := range o.Archive.Entries {
+		assert.Equal(t, ns, e.Namespace, "namespace for entry %s", e.Name)
+		assert.Equal(t, "gcpSecretsManager", e.BackendType, "backend type for entry %s", e.Name)
+		assert.Equal(t, location, e.Location, "location for entry %s", e.Name)
+		values[e.ExternalSecret+"/"+e.Name] = e.Value
+	}
+	// the lighthouse-hmac-token key has no value in the secret store so is not backed up
+	assert.Equal(t, map[string]string{
+		"jx-basic-auth/username":       "admin",
+		"jx-basic-auth/password":       "my-password",
+		"lighthouse-oauth-token/oauth": "my-oauth-token",
+	}, values, "archive values")
+
+	encryption, err := backups.DetectEncryption(o.OutFile)
+	require.NoError(t, err, "failed to detect encryption of %s", o.OutFile)
+	assert.Equal(t, backups.EncryptionAge, encryption, "encryption of %s", o.OutFile)
+
+	data, err := os.ReadFile(o.OutFile)
+	require.NoError(t, err, "failed to read %s", o.OutFile)
+	assert.NotContains(t, string(data), "my-password", "the archive should be encrypted")
+
+	o.AgeIdentities = []string{"key.txt"}
+	decrypted, err := o.Decrypt(o.OutFile)
+	require.NoError(t, err, "failed to decrypt %s", o.OutFile)
+	archive, err := backups.ParseArchive(decrypted)
+	require.NoError(t, err, "failed to parse archive %s", o.OutFile)
+	assert.Len(t, archive.Entries, 3, "archive entries")
+}
+
+func TestBackupFailsOnSecretStoreError(t *testing.T) {
+	var err error
+	ns := "jx"
+
+	_, o := backup.NewCmdBackup()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretStoreManagerFactory = &testsecrets.FailingSecretManagerFactory{Err: errors.New("permission denied")}
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	o.OutFile = filepath.Join(t.TempDir(), "secrets-backup.age")
+	o.AgeRecipients = []string{"age1dummy"}
+	o.Encrypter.CommandRunner = testbackups.NewFakeAgeRunner(t)
+
+	err = o.Run()
+	require.Error(t, err, "should fail to back up when the secret store fails")
+	assert.Contains(t, err.Error(), "permission denied", "error")
+	assert.NoFileExists(t, o.OutFile, "should not write a partial archive")
+}
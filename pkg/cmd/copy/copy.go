@@ -3,6 +3,7 @@ package copy
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 
@@ -15,12 +16,17 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 var (
@@ -36,6 +42,15 @@ var (
 
 		# copy secrets by name from the current namespace 
 		jx secret copy --name my-awesome-secret --to my-preview-ns
+
+		# keep copying secrets by label to all the namespaces with a label as the secrets change
+		jx secret copy --selector mylabel=cheese --to-selector preview=true --watch
+
+		# copy some keys of a secret to another cluster renaming one of the keys
+		jx secret copy --name my-awesome-secret --to jx-production --to-context production --key username --key password --map password=token
+
+		# copy a secret with a different name without its helm labels
+		jx secret copy --name my-awesome-secret --to my-preview-ns --to-name my-app-secret --exclude-key email --strip-label 'helm.sh/*'
 	`)
 )
 
@@ -43,11 +58,32 @@ var (
 type Options struct {
 	Namespace              string
 	ToNamespace            string
+	ToSelector             string
 	Selector               string
 	Name                   string
 	CreateNamespace        bool
 	IgnoreMissingNamespace bool
+	Watch                  bool
+	ToContext              string
+	ToKubeConfig           string
+	ToName                 string
+	Keys                   []string
+	ExcludeKeys            []string
+	KeyMappings            []string
+	StripLabels            []string
+	StripAnnotations       []string
+	Mirror                 bool
+	ServerSideApply        bool
+	ForceConflicts         bool
+	FieldManager           string
 	KubeClient             kubernetes.Interface
+	ToKubeClient           kubernetes.Interface
+
+	// Changes the changes made to the copied secrets
+	Changes []*SecretChange
+
+	namespaceStore cache.Store
+	keyMap         map[string]string
 }
 
 // NewCmdCopy creates a command object for the command
@@ -67,52 +103,100 @@ func NewCmdCopy() (*cobra.Command, *Options) {
 	cmd.Flags().StringVarP(&o.Namespace, "ns", "n", "", "the namespace to filter the Secret resources")
 	cmd.Flags().StringVarP(&o.Name, "name", "", "", "the name of the Secret to copy")
 	cmd.Flags().StringVarP(&o.ToNamespace, "to", "t", "", "the namespace to copy the secrets to")
+	cmd.Flags().StringVarP(&o.ToSelector, "to-selector", "", "", "the label selector of the namespaces to copy the secrets to")
 	cmd.Flags().StringVarP(&o.Selector, "selector", "l", "", "the label selector to find the secrets to copy")
 	cmd.Flags().BoolVarP(&o.CreateNamespace, "create-namespace", "", false, "create the to Namespace if it does not already exist")
 	cmd.Flags().BoolVarP(&o.IgnoreMissingNamespace, "ignore-missing-to", "", false, "ignore this command if the target namespace does not exist")
+	cmd.Flags().BoolVarP(&o.Watch, "watch", "w", false, "keeps watching the secrets and namespaces so that the copies are created, updated and deleted as the source secrets change")
+	cmd.Flags().StringVarP(&o.ToContext, "to-context", "", "", "the kubeconfig context of the cluster to copy the secrets to. Defaults to the current cluster")
+	cmd.Flags().StringVarP(&o.ToKubeConfig, "to-kubeconfig", "", "", "the kubeconfig file of the cluster to copy the secrets to. Defaults to the current kubeconfig")
+	cmd.Flags().StringArrayVarP(&o.Keys, "key", "k", nil, "the keys of the secret data to copy. Defaults to all keys")
+	cmd.Flags().StringArrayVarP(&o.ExcludeKeys, "exclude-key", "", nil, "the keys of the secret data to not copy")
+	cmd.Flags().StringArrayVarP(&o.KeyMappings, "map", "m", nil, "renames a key when copying using the syntax 'src=dst'")
+	cmd.Flags().StringVarP(&o.ToName, "to-name", "", "", "the name of the copied secret if using --name. Defaults to the name of the source secret")
+	cmd.Flags().StringArrayVarP(&o.StripLabels, "strip-label", "", nil, "the label keys to remove from the copy. A trailing '*' removes all labels with the prefix")
+	cmd.Flags().BoolVarP(&o.Mirror, "mirror", "", false, "removes any data keys from the copy which are not in the source")
+	cmd.Flags().BoolVarP(&o.ServerSideApply, "server-side", "", false, "uses server side apply so that fields owned by other controllers are not modified")
+	cmd.Flags().StringVarP(&o.FieldManager, "field-manager", "", extsecrets.DefaultFieldManager, "the field manager used with server side apply")
+	cmd.Flags().BoolVarP(&o.ForceConflicts, "force-conflicts", "", false, "takes ownership of fields owned by other field managers when using server side apply rather than failing")
+	cmd.Flags().StringArrayVarP(&o.StripAnnotations, "strip-annotation", "", nil, "the annotation keys to remove from the copy. A trailing '*' removes all annotations with the prefix")
 	return cmd, o
 }
 
-// Run implements the command
-func (o *Options) Run() error {
-	if o.ToNamespace == "" {
+// Validate verifies the options are valid
+func (o *Options) Validate() error {
+	if o.ToNamespace == "" && o.ToSelector == "" {
 		return options.MissingOption("to")
 	}
 	if o.Selector == "" && o.Name == "" {
 		return options.MissingOption("selector")
 	}
+	if o.ToName != "" && o.Name == "" {
+		return options.MissingOption("name")
+	}
+	if o.Mirror && o.ServerSideApply {
+		return errors.Errorf("cannot use --mirror with --server-side as server side apply only removes the data keys it previously applied")
+	}
+	if o.ForceConflicts && !o.ServerSideApply {
+		return errors.Errorf("--force-conflicts can only be used with --server-side")
+	}
 
 	var err error
+	o.keyMap, err = parseKeyMappings(o.KeyMappings)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the key mappings")
+	}
+	return nil
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return err
+	}
 	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create kube client")
 	}
-
-	if o.IgnoreMissingNamespace {
-		ctx := context.TODO()
-		_, err = o.KubeClient.CoreV1().Namespaces().Get(ctx, o.ToNamespace, metav1.GetOptions{})
+	if o.ToKubeClient == nil && (o.ToContext != "" || o.ToKubeConfig != "") {
+		o.ToKubeClient, err = o.createToKubeClient()
 		if err != nil {
-			if apierrors.IsNotFound(err) {
-				log.Logger().Infof("not copying secrets as the namespace %s does not exist", info(o.ToNamespace))
-				return nil
-			}
-			log.Logger().Warnf("could not check if namespace %s exists: %s", o.ToNamespace, err.Error())
+			return errors.Wrapf(err, "failed to create kube client for the target cluster")
 		}
-	} else if o.CreateNamespace {
-		err = jxenv.EnsureNamespaceCreated(o.KubeClient, o.ToNamespace, nil, nil)
-		if err != nil {
-			return errors.Wrapf(err, "failed to create namespace %s", o.ToNamespace)
+	}
+	toClient := o.toKubeClient()
+
+	if o.ToNamespace != "" {
+		if o.IgnoreMissingNamespace {
+			ctx := context.TODO()
+			_, err = toClient.CoreV1().Namespaces().Get(ctx, o.ToNamespace, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					log.Logger().Infof("not copying secrets as the namespace %s does not exist", info(o.ToNamespace))
+					return nil
+				}
+				log.Logger().Warnf("could not check if namespace %s exists: %s", o.ToNamespace, err.Error())
+			}
+		} else if o.CreateNamespace {
+			err = jxenv.EnsureNamespaceCreated(toClient, o.ToNamespace, nil, nil)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create namespace %s", o.ToNamespace)
+			}
 		}
 	}
-	ns := o.Namespace
-	selector := o.Selector
-	listOptions := metav1.ListOptions{
-		LabelSelector: selector,
+
+	if o.Watch {
+		return o.Sync(context.Background())
 	}
-	if o.Name != "" {
-		listOptions.FieldSelector = fields.OneTermEqualSelector("metadata.name", o.Name).String()
+
+	targets, err := o.findTargetNamespaces()
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the namespaces to copy to")
 	}
-	secrets, err := o.KubeClient.CoreV1().Secrets(ns).List(context.TODO(), listOptions)
+	ns := o.Namespace
+	selector := o.Selector
+	secrets, err := o.KubeClient.CoreV1().Secrets(ns).List(context.TODO(), o.secretListOptions())
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Logger().Warnf("no Secrets in namespace %s with selector %s", ns, selector)
@@ -120,17 +204,128 @@ func (o *Options) Run() error {
 		}
 		return errors.Wrapf(err, "failed to find Secrets in namespace %s with selector %s", ns, selector)
 	}
+	o.Changes = nil
 	for i := range secrets.Items {
 		secret := &secrets.Items[i]
-
-		// in unit tests the field selector doesn't tend to work with fake clients so lets add an extra check here...
-		if o.Name != "" && secret.Name != o.Name {
+		if !o.matchesSecret(secret) {
 			continue
 		}
-		err = extsecrets.CopySecretToNamespace(o.KubeClient, o.ToNamespace, secret)
-		if err != nil {
-			return errors.Wrapf(err, "failed to copy secret %s to namespace %s", secret.Name, o.ToNamespace)
+		for _, toNS := range targets {
+			changes, err := o.copySecret(secret, toNS)
+			if err != nil {
+				return err
+			}
+			o.Changes = append(o.Changes, changes...)
 		}
 	}
+
+	if len(o.Changes) > 0 {
+		t := table.CreateTable(os.Stdout)
+		t.AddRow("NAMESPACE", "SECRET", "KEY", "CHANGE")
+		for _, c := range o.Changes {
+			t.AddRow(c.Namespace, c.Name, c.Key, c.Change)
+		}
+		t.Render()
+	}
 	return nil
 }
+
+// toKubeClient returns the client of the cluster to copy to
+func (o *Options) toKubeClient() kubernetes.Interface {
+	if o.ToKubeClient != nil {
+		return o.ToKubeClient
+	}
+	return o.KubeClient
+}
+
+// createToKubeClient creates the client of the cluster to copy to from the kubeconfig file and context
+func (o *Options) createToKubeClient() (kubernetes.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if o.ToKubeConfig != "" {
+		rules.ExplicitPath = o.ToKubeConfig
+	}
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: o.ToContext,
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load kubeconfig context %s", o.ToContext)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create kube client for context %s", o.ToContext)
+	}
+	return client, nil
+}
+
+func (o *Options) secretListOptions() metav1.ListOptions {
+	listOptions := metav1.ListOptions{
+		LabelSelector: o.Selector,
+	}
+	if o.Name != "" {
+		listOptions.FieldSelector = fields.OneTermEqualSelector("metadata.name", o.Name).String()
+	}
+	return listOptions
+}
+
+// matchesSecret returns true if the secret should be copied
+func (o *Options) matchesSecret(secret *corev1.Secret) bool {
+	// in unit tests the field selector doesn't tend to work with fake clients so lets add an extra check here...
+	return o.Name == "" || secret.Name == o.Name
+}
+
+// findTargetNamespaces returns the namespace to copy to along with any namespaces matching the selector
+func (o *Options) findTargetNamespaces() ([]string, error) {
+	var answer []string
+	if o.ToNamespace != "" {
+		answer = append(answer, o.ToNamespace)
+	}
+	if o.ToSelector == "" {
+		return answer, nil
+	}
+	namespaces, err := o.toKubeClient().CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{LabelSelector: o.ToSelector})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list namespaces with selector %s", o.ToSelector)
+	}
+	for i := range namespaces.Items {
+		name := namespaces.Items[i].Name
+		if (name != o.Namespace || o.ToKubeClient != nil) && stringhelpers.StringArrayIndex(answer, name) < 0 {
+			answer = append(answer, name)
+		}
+	}
+	return answer, nil
+}
+
+// copySecret copies the secret to the given namespace annotating the copy with its source and returns the changes made
+func (o *Options) copySecret(secret *corev1.Secret, ns string) ([]*SecretChange, error) {
+	copied := o.transformSecret(secret)
+	if ns == secret.Namespace && copied.Name == secret.Name && o.ToKubeClient == nil {
+		return nil, nil
+	}
+	if copied.Annotations == nil {
+		copied.Annotations = map[string]string{}
+	}
+	copied.Annotations[extsecrets.CopySourceAnnotation] = secret.Namespace + "/" + secret.Name
+
+	client := o.toKubeClient()
+	var currentData map[string][]byte
+	current, err := client.CoreV1().Secrets(ns).Get(context.TODO(), copied.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed to get Secret %s in namespace %s", copied.Name, ns)
+	}
+	if current != nil {
+		currentData = current.Data
+	}
+
+	copyOptions := extsecrets.CopyOptions{
+		Mirror:          o.Mirror,
+		ServerSideApply: o.ServerSideApply,
+		FieldManager:    o.FieldManager,
+		ForceConflicts:  o.ForceConflicts,
+	}
+	err = extsecrets.CopySecretToNamespaceWithOptions(client, ns, copied, copyOptions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to copy secret %s to namespace %s", secret.Name, ns)
+	}
+	return diffSecretData(ns, copied.Name, currentData, copied.Data, o.Mirror), nil
+}
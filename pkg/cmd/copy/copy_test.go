@@ -3,8 +3,10 @@ package copy_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/copy"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/testhelpers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -145,3 +147,249 @@ func TestCopyNoSelectorOrNameFails(t *testing.T) {
 	err := o.Run()
 	require.Error(t, err, "should have failed")
 }
+
+func TestCopyWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "preview-1",
+				Labels: map[string]string{"preview": "true"},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "lighthouse-oauth-token",
+				Namespace: ns,
+				Labels: map[string]string{
+					"beer": "stella",
+				},
+			},
+			Data: map[string][]byte{
+				"oauth": []byte("dummyPipelineUserToken"),
+			},
+		},
+	)
+
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = kubeClient
+	o.Selector = "beer=stella"
+	o.ToSelector = "preview=true"
+
+	done := make(chan error, 1)
+	go func() {
+		done <- o.Sync(ctx)
+	}()
+
+	secretValue := func(toNS, name string) func() bool {
+		return func() bool {
+			secret, err := kubeClient.CoreV1().Secrets(toNS).Get(ctx, "lighthouse-oauth-token", metav1.GetOptions{})
+			if err != nil {
+				return name == ""
+			}
+			return string(secret.Data["oauth"]) == name && secret.Annotations[extsecrets.CopySourceAnnotation] == ns+"/lighthouse-oauth-token"
+		}
+	}
+	waitFor := 5 * time.Second
+	tick := 10 * time.Millisecond
+	require.Eventually(t, secretValue("preview-1", "dummyPipelineUserToken"), waitFor, tick, "should have copied the secret")
+
+	// lets update the source
+	source, err := kubeClient.CoreV1().Secrets(ns).Get(ctx, "lighthouse-oauth-token", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get source secret")
+	source.Data["oauth"] = []byte("rotatedToken")
+	_, err = kubeClient.CoreV1().Secrets(ns).Update(ctx, source, metav1.UpdateOptions{})
+	require.NoError(t, err, "failed to update source secret")
+	require.Eventually(t, secretValue("preview-1", "rotatedToken"), waitFor, tick, "should have updated the copy")
+
+	// new namespaces should get a copy
+	_, err = kubeClient.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "preview-2",
+			Labels: map[string]string{"preview": "true"},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create namespace")
+	require.Eventually(t, secretValue("preview-2", "rotatedToken"), waitFor, tick, "should have copied to the new namespace")
+
+	// deleting the source should delete the copies
+	err = kubeClient.CoreV1().Secrets(ns).Delete(ctx, "lighthouse-oauth-token", metav1.DeleteOptions{})
+	require.NoError(t, err, "failed to delete source secret")
+	require.Eventually(t, secretValue("preview-1", ""), waitFor, tick, "should have deleted the copy")
+	require.Eventually(t, secretValue("preview-2", ""), waitFor, tick, "should have deleted the copy")
+
+	cancel()
+	require.NoError(t, <-done, "failed to sync")
+}
+
+func TestCopyToOtherClusterWithKeyMappings(t *testing.T) {
+	ctx := context.TODO()
+	toClient := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "knative-docker-user-pass",
+				Namespace: "jx-production",
+			},
+			Data: map[string][]byte{
+				"username": []byte("dummyDockerUsername"),
+				"token":    []byte("oldToken"),
+			},
+		},
+	)
+
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "knative-docker-user-pass",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"username": []byte("dummyDockerUsername"),
+				"password": []byte("dummyDockerPassword"),
+				"email":    []byte("someone@acme.com"),
+			},
+		},
+	)
+	o.ToKubeClient = toClient
+	o.ToNamespace = "jx-production"
+	o.Name = "knative-docker-user-pass"
+	o.Keys = []string{"username", "password"}
+	o.KeyMappings = []string{"password=token"}
+	err := o.Run()
+	require.NoError(t, err, "failed to run copy")
+
+	secret, err := toClient.CoreV1().Secrets(o.ToNamespace).Get(ctx, o.Name, metav1.GetOptions{})
+	require.NoError(t, err, "failed to find copied secret in the other cluster")
+	assert.Equal(t, "dummyDockerPassword", string(secret.Data["token"]), "renamed key")
+	assert.NotContains(t, secret.Data, "email", "should have filtered out the key")
+	assert.NotContains(t, secret.Data, "password", "should have renamed the key")
+
+	changes := map[string]string{}
+	for _, c := range o.Changes {
+		changes[c.Key] = c.Change
+	}
+	assert.Equal(t, map[string]string{"token": copy.ChangeUpdated, "username": copy.ChangeUnchanged}, changes, "changes")
+
+	_, err = o.KubeClient.CoreV1().Secrets(o.ToNamespace).Get(ctx, o.Name, metav1.GetOptions{})
+	require.Error(t, err, "should not have copied to the source cluster")
+}
+
+func TestCopyWithTransformations(t *testing.T) {
+	ctx := context.TODO()
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "shared-db",
+				Namespace: ns,
+				Labels: map[string]string{
+					"app":                          "db",
+					"helm.sh/chart":                "db-1.0.0",
+					"app.kubernetes.io/managed-by": "Helm",
+				},
+				Annotations: map[string]string{
+					"meta.helm.sh/release-name": "db",
+					"owner":                     "platform",
+				},
+			},
+			Data: map[string][]byte{
+				"username": []byte("dbuser"),
+				"password": []byte("dbpassword"),
+				"root":     []byte("rootpassword"),
+			},
+		},
+	)
+	o.ToNamespace = "my-preview-env"
+	o.Name = "shared-db"
+	o.ToName = "my-app-db"
+	o.ExcludeKeys = []string{"root"}
+	o.KeyMappings = []string{"username=DB_USER", "password=DB_PASSWORD"}
+	o.StripLabels = []string{"helm.sh/*", "app.kubernetes.io/managed-by"}
+	o.StripAnnotations = []string{"meta.helm.sh/*"}
+	err := o.Run()
+	require.NoError(t, err, "failed to run copy")
+
+	secret, err := o.KubeClient.CoreV1().Secrets(o.ToNamespace).Get(ctx, "my-app-db", metav1.GetOptions{})
+	require.NoError(t, err, "failed to find renamed secret")
+	assert.Equal(t, map[string][]byte{
+		"DB_USER":     []byte("dbuser"),
+		"DB_PASSWORD": []byte("dbpassword"),
+	}, secret.Data, "data")
+	assert.Equal(t, map[string]string{"app": "db"}, secret.Labels, "labels")
+	assert.Equal(t, map[string]string{
+		"owner":                         "platform",
+		extsecrets.CopySourceAnnotation: ns + "/shared-db",
+	}, secret.Annotations, "annotations")
+}
+
+func TestCopyToNameRequiresName(t *testing.T) {
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+	o.ToNamespace = "my-preview-env"
+	o.Selector = "beer=stella"
+	o.ToName = "cheese"
+	err := o.Run()
+	require.Error(t, err, "should have failed")
+}
+
+func TestCopyMirrorRemovesStaleKeys(t *testing.T) {
+	ctx := context.TODO()
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "lighthouse-oauth-token",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"oauth": []byte("newToken"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "lighthouse-oauth-token",
+				Namespace: "my-preview-env",
+			},
+			Data: map[string][]byte{
+				"oauth":    []byte("oldToken"),
+				"oldOauth": []byte("staleToken"),
+			},
+		},
+	)
+	o.ToNamespace = "my-preview-env"
+	o.Name = "lighthouse-oauth-token"
+	o.Mirror = true
+	err := o.Run()
+	require.NoError(t, err, "failed to run copy")
+
+	secret, err := o.KubeClient.CoreV1().Secrets(o.ToNamespace).Get(ctx, o.Name, metav1.GetOptions{})
+	require.NoError(t, err, "failed to find copied secret")
+	assert.Equal(t, map[string][]byte{"oauth": []byte("newToken")}, secret.Data, "should have mirrored the data")
+
+	changes := map[string]string{}
+	for _, c := range o.Changes {
+		changes[c.Key] = c.Change
+	}
+	assert.Equal(t, map[string]string{"oauth": copy.ChangeUpdated, "oldOauth": copy.ChangeRemoved}, changes, "changes")
+}
+
+func TestCopyMirrorWithServerSideApplyFails(t *testing.T) {
+	_, o := copy.NewCmdCopy()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+	o.ToNamespace = "my-preview-env"
+	o.Name = "lighthouse-oauth-token"
+	o.Mirror = true
+	o.ServerSideApply = true
+	err := o.Run()
+	require.Error(t, err, "should not support --mirror with --server-side")
+	assert.Contains(t, err.Error(), "--mirror", "error message")
+}
@@ -0,0 +1,177 @@
+package copy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Sync keeps the copies of the secrets in step with the source secrets until the context is done
+func (o *Options) Sync(ctx context.Context) error {
+	if o.ToSelector != "" {
+		store, ctrl := cache.NewInformerWithOptions(
+			cache.InformerOptions{
+				ListerWatcher: &cache.ListWatch{
+					ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+						options.LabelSelector = o.ToSelector
+						return o.toKubeClient().CoreV1().Namespaces().List(ctx, options)
+					},
+					WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+						options.LabelSelector = o.ToSelector
+						return o.toKubeClient().CoreV1().Namespaces().Watch(ctx, options)
+					},
+				},
+				ObjectType: &corev1.Namespace{},
+				Handler: cache.ResourceEventHandlerFuncs{
+					AddFunc: func(obj interface{}) {
+						if namespace, ok := obj.(*corev1.Namespace); ok {
+							o.onNamespace(ctx, namespace.Name)
+						}
+					},
+				},
+				ResyncPeriod: time.Minute * 10,
+			})
+		o.namespaceStore = store
+		go ctrl.Run(ctx.Done())
+
+		if !cache.WaitForCacheSync(ctx.Done(), ctrl.HasSynced) {
+			return errors.Errorf("failed to load the namespaces with selector %s", o.ToSelector)
+		}
+	}
+
+	log.Logger().Infof("watching for Secrets in namespace %s with selector %s", info(o.Namespace), info(o.Selector))
+	listOptions := o.secretListOptions()
+	_, ctrl := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					options.LabelSelector = listOptions.LabelSelector
+					options.FieldSelector = listOptions.FieldSelector
+					return o.KubeClient.CoreV1().Secrets(o.Namespace).List(ctx, options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					options.LabelSelector = listOptions.LabelSelector
+					options.FieldSelector = listOptions.FieldSelector
+					return o.KubeClient.CoreV1().Secrets(o.Namespace).Watch(ctx, options)
+				},
+			},
+			ObjectType: &corev1.Secret{},
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					o.onSecret(obj)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					o.onSecret(newObj)
+				},
+				DeleteFunc: func(obj interface{}) {
+					if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+						obj = tombstone.Obj
+					}
+					if secret, ok := obj.(*corev1.Secret); ok && o.matchesSecret(secret) {
+						o.deleteCopies(ctx, secret)
+					}
+				},
+			},
+			ResyncPeriod: time.Minute * 10,
+		})
+	ctrl.Run(ctx.Done())
+	return nil
+}
+
+// syncTargetNamespaces returns the current namespaces to copy to
+func (o *Options) syncTargetNamespaces() []string {
+	var answer []string
+	if o.ToNamespace != "" {
+		answer = append(answer, o.ToNamespace)
+	}
+	if o.namespaceStore != nil {
+		for _, name := range o.namespaceStore.ListKeys() {
+			if (name != o.Namespace || o.ToKubeClient != nil) && name != o.ToNamespace {
+				answer = append(answer, name)
+			}
+		}
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+func (o *Options) onSecret(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || !o.matchesSecret(secret) {
+		return
+	}
+	for _, ns := range o.syncTargetNamespaces() {
+		changes, err := o.copySecret(secret, ns)
+		if err != nil {
+			log.Logger().Warnf("%s", err.Error())
+		}
+		logChanges(changes)
+	}
+}
+
+func logChanges(changes []*SecretChange) {
+	for _, c := range changes {
+		if c.Change != ChangeUnchanged {
+			log.Logger().Infof("Secret %s in namespace %s key %s %s", info(c.Name), info(c.Namespace), info(c.Key), c.Change)
+		}
+	}
+}
+
+// onNamespace copies all the current source secrets to a new target namespace
+func (o *Options) onNamespace(ctx context.Context, ns string) {
+	if ns == o.Namespace && o.ToKubeClient == nil {
+		return
+	}
+	secrets, err := o.KubeClient.CoreV1().Secrets(o.Namespace).List(ctx, o.secretListOptions())
+	if err != nil {
+		log.Logger().Warnf("failed to list Secrets in namespace %s: %s", o.Namespace, err.Error())
+		return
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !o.matchesSecret(secret) {
+			continue
+		}
+		changes, err := o.copySecret(secret, ns)
+		if err != nil {
+			log.Logger().Warnf("%s", err.Error())
+		}
+		logChanges(changes)
+	}
+}
+
+// deleteCopies deletes the copies of the given source secret
+func (o *Options) deleteCopies(ctx context.Context, source *corev1.Secret) {
+	sourceName := source.Namespace + "/" + source.Name
+	name := o.targetName(source)
+	for _, ns := range o.syncTargetNamespaces() {
+		secretInterface := o.toKubeClient().CoreV1().Secrets(ns)
+		secret, err := secretInterface.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Logger().Warnf("failed to get Secret %s in namespace %s: %s", name, ns, err.Error())
+			}
+			continue
+		}
+		if secret.Annotations[extsecrets.CopySourceAnnotation] != sourceName {
+			log.Logger().Debugf("not deleting Secret %s in namespace %s as it is not a copy of %s", name, ns, sourceName)
+			continue
+		}
+		err = secretInterface.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Logger().Warnf("failed to delete Secret %s in namespace %s: %s", name, ns, err.Error())
+			continue
+		}
+		log.Logger().Infof("deleted Secret %s in namespace %s", info(name), info(ns))
+	}
+}
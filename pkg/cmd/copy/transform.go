@@ -0,0 +1,146 @@
+package copy
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ChangeAdded the key was added to the copy
+	ChangeAdded = "added"
+	// ChangeUpdated the value of the key was changed in the copy
+	ChangeUpdated = "updated"
+	// ChangeUnchanged the value of the key was already up to date in the copy
+	ChangeUnchanged = "unchanged"
+	// ChangeRemoved the key was removed from the copy as it is not in the source
+	ChangeRemoved = "removed"
+)
+
+// SecretChange describes the change made to a key of a copied secret without including the value
+type SecretChange struct {
+	// Namespace the namespace of the copy
+	Namespace string
+	// Name the name of the copy
+	Name string
+	// Key the data key
+	Key string
+	// Change the kind of change
+	Change string
+}
+
+// parseKeyMappings parses the 'src=dst' key mappings
+func parseKeyMappings(mappings []string) (map[string]string, error) {
+	answer := map[string]string{}
+	for _, m := range mappings {
+		src, dst, ok := strings.Cut(m, "=")
+		src = strings.TrimSpace(src)
+		dst = strings.TrimSpace(dst)
+		if !ok || src == "" || dst == "" {
+			return nil, errors.Errorf("invalid key mapping '%s' should be of the form 'src=dst'", m)
+		}
+		answer[src] = dst
+	}
+	return answer, nil
+}
+
+// transformSecret returns a copy of the secret with the name, keys, labels and annotations transformed
+func (o *Options) transformSecret(secret *corev1.Secret) *corev1.Secret {
+	answer := secret.DeepCopy()
+	answer.Name = o.targetName(secret)
+	answer.Labels = stripKeys(answer.Labels, o.StripLabels)
+	answer.Annotations = stripKeys(answer.Annotations, o.StripAnnotations)
+	if len(o.Keys) == 0 && len(o.ExcludeKeys) == 0 && len(o.keyMap) == 0 {
+		return answer
+	}
+	answer.Data = map[string][]byte{}
+	for k, v := range secret.Data {
+		if len(o.Keys) > 0 && stringhelpers.StringArrayIndex(o.Keys, k) < 0 {
+			continue
+		}
+		if stringhelpers.StringArrayIndex(o.ExcludeKeys, k) >= 0 {
+			continue
+		}
+		if dst := o.keyMap[k]; dst != "" {
+			k = dst
+		}
+		answer.Data[k] = v
+	}
+	return answer
+}
+
+// targetName returns the name of the copy of the given secret
+func (o *Options) targetName(secret *corev1.Secret) string {
+	if o.ToName != "" {
+		return o.ToName
+	}
+	return secret.Name
+}
+
+// stripKeys removes the keys matching the rules from the map. A rule ending with '*' matches any key with the prefix
+func stripKeys(m map[string]string, rules []string) map[string]string {
+	if len(m) == 0 || len(rules) == 0 {
+		return m
+	}
+	answer := map[string]string{}
+	for k, v := range m {
+		if !matchesAnyRule(k, rules) {
+			answer[k] = v
+		}
+	}
+	return answer
+}
+
+func matchesAnyRule(key string, rules []string) bool {
+	for _, rule := range rules {
+		if prefix, ok := strings.CutSuffix(rule, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSecretData returns the changes made to the current data by the new data
+func diffSecretData(ns, name string, current, data map[string][]byte, mirror bool) []*SecretChange {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	if mirror {
+		for k := range current {
+			if _, ok := data[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var answer []*SecretChange
+	for _, k := range keys {
+		change := ChangeUnchanged
+		old, ok := current[k]
+		value, exists := data[k]
+		if !exists {
+			change = ChangeRemoved
+		} else if !ok {
+			change = ChangeAdded
+		} else if !bytes.Equal(old, value) {
+			change = ChangeUpdated
+		}
+		answer = append(answer, &SecretChange{
+			Namespace: ns,
+			Name:      name,
+			Key:       k,
+			Change:    change,
+		})
+	}
+	return answer
+}
@@ -0,0 +1,216 @@
+package dedupe
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/secretmapping"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdLong = templates.LongDesc(`
+		Reports the locations in the underlying secret storage which are shared by more than one ExternalSecret
+
+		The locations are those of the rules in the secret-mappings.yaml file. When several ExternalSecrets use the same location only the canonical one is populated. The canonical ExternalSecret is the one pinned in the secret-mappings.yaml file, otherwise the one with a schema with the most properties.
+
+		A warning is shown if the schema properties of the ExternalSecrets sharing a location disagree such as using different generators, templates or formats.
+
+		Use --pin to pin the canonical ExternalSecret in the secret-mappings.yaml file.
+`)
+
+	cmdExample = templates.Examples(`
+		# report the shared locations
+		%s dedupe
+
+		# pin the canonical ExternalSecret for the locations it shares
+		%s dedupe --pin jx/lighthouse-oauth-token
+	`)
+)
+
+// Options the options for the command
+type Options struct {
+	secretfacade.Options
+
+	Pin     string
+	Results []*secretfacade.SharedDestination
+}
+
+// NewCmdDedupe creates a command object for the command
+func NewCmdDedupe() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "dedupe",
+		Aliases: []string{"shared"},
+		Short:   "Reports the locations in the underlying secret storage which are shared by more than one ExternalSecret",
+		Long:    cmdLong,
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "the namespace to filter the ExternalSecret resources")
+	cmd.Flags().StringVarP(&o.Dir, "dir", "d", ".", "the directory to look for the .jx/secret/mapping/secret-mappings.yaml file")
+	cmd.Flags().StringVarP(&o.Pin, "pin", "", "", "the name or namespace/name of the ExternalSecret to pin as the canonical one in the secret-mappings.yaml file")
+	o.Options.AddFlags(cmd)
+	return cmd, o
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating options")
+	}
+
+	pairs, err := o.Load()
+	if err != nil {
+		return errors.Wrap(err, "failed to load ExternalSecret and Secret pairs")
+	}
+
+	secretMapping, fileName, err := secretmapping.LoadSecretMapping(o.Dir, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load secret mappings in dir %s", o.Dir)
+	}
+
+	shared := secretfacade.FindSharedDestinations(pairs, secretMapping)
+	if o.Pin != "" {
+		err = o.pin(shared, secretMapping, fileName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to pin ExternalSecret %s", o.Pin)
+		}
+		shared = secretfacade.FindSharedDestinations(pairs, secretMapping)
+	}
+
+	o.Results = nil
+	for _, sd := range shared {
+		if o.matches(sd) {
+			o.Results = append(o.Results, sd)
+		}
+	}
+	if len(o.Results) == 0 {
+		log.Logger().Infof("no locations in the secret storage are shared by more than one of the %d ExternalSecrets", len(pairs))
+		return nil
+	}
+
+	t := table.CreateTable(os.Stdout)
+	t.AddRow("LOCATION", "SECRET", "ENTRY", "CANONICAL")
+	for _, sd := range o.Results {
+		for i, e := range sd.Entries {
+			canonical := ""
+			if i == 0 {
+				canonical = termcolor.ColorInfo("canonical")
+				if sd.Pinned {
+					canonical = termcolor.ColorInfo("pinned")
+				}
+			}
+			t.AddRow(sd.Destination, e.Secret.Key(), e.Name, canonical)
+		}
+	}
+	t.Render()
+
+	for _, sd := range o.Results {
+		for _, message := range sd.SchemaConflicts {
+			log.Logger().Warnf("the schemas for location %s disagree: %s", termcolor.ColorInfo(sd.Destination), termcolor.ColorWarning(message))
+		}
+	}
+	if o.Pin == "" {
+		log.Logger().Infof("to pin the canonical ExternalSecret use: %s", termcolor.ColorInfo(fmt.Sprintf("%s dedupe --pin namespace/name", rootcmd.BinaryName)))
+	}
+	return nil
+}
+
+// matches returns true if any of the secrets sharing the destination match the filters
+func (o *Options) matches(sd *secretfacade.SharedDestination) bool {
+	if !o.HasFilters() {
+		return true
+	}
+	for _, e := range sd.Entries {
+		if o.Matches(e.Secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// pin pins the secret as the canonical secret then saves the secret mappings
+func (o *Options) pin(shared []*secretfacade.SharedDestination, secretMapping *v1alpha1.SecretMapping, fileName string) error {
+	if fileName == "" {
+		return errors.Errorf("no %s file found in dir %s", v1alpha1.SecretMappingFileName, o.Dir)
+	}
+	ns, name := "", o.Pin
+	idx := strings.Index(o.Pin, "/")
+	if idx >= 0 {
+		ns, name = o.Pin[:idx], o.Pin[idx+1:]
+	}
+
+	var target *secretfacade.SecretPair
+	var others []*secretfacade.SecretPair
+	for _, sd := range shared {
+		var found *secretfacade.SecretPair
+		for _, e := range sd.Entries {
+			if e.Secret.Name() == name && (ns == "" || e.Secret.Namespace() == ns) {
+				found = e.Secret
+				break
+			}
+		}
+		if found == nil {
+			continue
+		}
+		if target != nil && target.Key() != found.Key() {
+			return errors.Errorf("the name %s is ambiguous so please specify the namespace/name", o.Pin)
+		}
+		target = found
+		for _, e := range sd.Entries {
+			if e.Secret != target {
+				others = append(others, e.Secret)
+			}
+		}
+	}
+	if target == nil {
+		return errors.Errorf("no ExternalSecret %s shares a location with another ExternalSecret", o.Pin)
+	}
+
+	// lets unpin the other secrets first in case they use the same rule as the target
+	secrets := secretMapping.Spec.Secrets
+	for _, other := range others {
+		for i := range secrets {
+			rule := &secrets[i]
+			if rule.Name == other.Name() && (rule.Namespace == "" || rule.Namespace == other.Namespace()) {
+				rule.Canonical = false
+			}
+		}
+	}
+	rule := secretMapping.FindRule(target.Namespace(), target.Name())
+	if rule.Name == target.Name() {
+		rule.Canonical = true
+		if rule.Namespace == "" {
+			log.Logger().Warnf("the secret mapping rule for %s has no namespace so it is pinned as canonical in every namespace", termcolor.ColorInfo(target.Name()))
+		}
+	} else {
+		secretMapping.Spec.Secrets = append(secretMapping.Spec.Secrets, v1alpha1.SecretRule{
+			Name:      target.Name(),
+			Namespace: target.Namespace(),
+			Canonical: true,
+		})
+	}
+
+	err := secretMapping.SaveConfig(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	log.Logger().Infof("pinned ExternalSecret %s as canonical in file %s", termcolor.ColorInfo(target.Key()), termcolor.ColorInfo(fileName))
+	return nil
+}
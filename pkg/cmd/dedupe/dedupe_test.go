@@ -0,0 +1,95 @@
+package dedupe_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/dedupe"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/secretmapping"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDedupe(t *testing.T) {
+	tmpDir := t.TempDir()
+	err := files.CopyDir("test_data", tmpDir, true)
+	require.NoError(t, err, "failed to copy test_data to %s", tmpDir)
+
+	var dynObjects []runtime.Object
+	for _, ns := range []string{"jx", "jx-staging"} {
+		dynObjects = append(dynObjects, testsecrets.LoadExtSecretDir(t, ns, filepath.Join(tmpDir, ns))...)
+	}
+
+	_, o := dedupe.NewCmdDedupe()
+	o.Dir = tmpDir
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretClient, err = extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...))
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run dedupe")
+
+	require.Len(t, o.Results, 1, "shared destinations")
+	sd := o.Results[0]
+	assert.Equal(t, "secret/data/jx/pipelineUser/token", sd.Destination, "destination")
+	assert.Equal(t, []string{"jx/jx-pipeline-git", "jx/lighthouse-oauth-token", "jx-staging/lighthouse-oauth-token"}, entryKeys(sd.Entries), "entries in canonical order")
+	assert.Equal(t, "password", sd.Entries[0].Name, "canonical entry name")
+	assert.False(t, sd.Pinned, "pinned")
+	assert.Equal(t, []string{
+		"no schema property for jx-staging/lighthouse-oauth-token",
+		`the minimum length differs: jx/jx-pipeline-git="8", jx/lighthouse-oauth-token=""`,
+	}, sd.SchemaConflicts, "schema conflicts")
+
+	// now lets pin the canonical secret
+	o.Pin = "jx/lighthouse-oauth-token"
+	err = o.Run()
+	require.NoError(t, err, "failed to run dedupe --pin")
+
+	require.Len(t, o.Results, 1, "shared destinations")
+	sd = o.Results[0]
+	// the rule for lighthouse-oauth-token has no namespace so it is canonical in every namespace
+	assert.Equal(t, []string{"jx/lighthouse-oauth-token", "jx-staging/lighthouse-oauth-token", "jx/jx-pipeline-git"}, entryKeys(sd.Entries), "entries in canonical order after pinning")
+	assert.True(t, sd.Pinned, "pinned")
+
+	secretMapping, _, err := secretmapping.LoadSecretMapping(tmpDir, true)
+	require.NoError(t, err, "failed to load secret mappings")
+	assert.Len(t, secretMapping.Spec.Secrets, 2, "the existing rule should be pinned rather than adding a duplicate rule")
+	assert.True(t, secretMapping.IsCanonical("jx", "lighthouse-oauth-token"), "should be canonical in jx")
+	assert.True(t, secretMapping.IsCanonical("jx-staging", "lighthouse-oauth-token"), "should be canonical in jx-staging")
+	assert.False(t, secretMapping.IsCanonical("jx", "jx-pipeline-git"), "should not be canonical")
+
+	// the secret populate keeps for the destination is the canonical one
+	o.Pin = ""
+	populateOptions := &secretfacade.Options{}
+	populateOptions.Dir = tmpDir
+	populateOptions.Namespace = "jx"
+	populateOptions.KubeClient = o.KubeClient
+	populateOptions.SecretClient = o.SecretClient
+	results, err := populateOptions.VerifyAndFilter()
+	require.NoError(t, err, "failed to verify and filter")
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.Key())
+	}
+	assert.Contains(t, keys, "jx/lighthouse-oauth-token", "the canonical secret should be populated")
+	assert.NotContains(t, keys, "jx/jx-pipeline-git", "the duplicate secret should be filtered out")
+
+	// an unknown secret cannot be pinned
+	o.Pin = "nexus"
+	err = o.Run()
+	require.Error(t, err, "should fail to pin a secret which does not share a location")
+}
+
+func entryKeys(entries []*secretfacade.SharedEntry) []string {
+	var answer []string
+	for _, e := range entries {
+		answer = append(answer, e.Secret.Key())
+	}
+	return answer
+}
@@ -0,0 +1,217 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdLong = templates.LongDesc(`
+		Compares the values in the underlying secret storage with the Kubernetes Secrets created from the ExternalSecrets
+
+		This lets you detect when the ExternalSecret controller has stopped synchronising secrets. Values are never displayed; hashes of the values using a random key for each run are shown instead so they can only be compared within the output.
+
+		The differences reported are:
+
+		* missing in store: the value is not in the secret storage
+		* stale in cluster: the value is in the secret storage but not in the Kubernetes Secret
+		* different: the value in the secret storage differs from the value in the Kubernetes Secret
+`)
+
+	cmdExample = templates.Examples(`
+		# compare all the secrets
+		%s diff
+
+		# fail if any secrets are different
+		%s diff --exit-code
+	`)
+)
+
+// Status the kind of difference between the secret store and the Kubernetes Secret
+type Status string
+
+const (
+	// StatusMissingInStore the value is not in the secret store
+	StatusMissingInStore Status = "missing in store"
+
+	// StatusStaleInCluster the value is in the secret store but not in the Kubernetes Secret
+	StatusStaleInCluster Status = "stale in cluster"
+
+	// StatusDifferent the value in the secret store differs from the value in the Kubernetes Secret
+	StatusDifferent Status = "different"
+)
+
+// Options the options for the command
+type Options struct {
+	secretfacade.Options
+
+	ExitCode bool
+	Results  []*Difference
+
+	secretManagers populate.SecretManagers
+	hasher         *masker.Hasher
+}
+
+// Difference a difference between the value in the secret store and the Kubernetes Secret
+type Difference struct {
+	// Namespace the namespace of the ExternalSecret
+	Namespace string
+	// Name the name of the ExternalSecret
+	Name string
+	// Entry the name of the entry in the Kubernetes Secret
+	Entry string
+	// Key the key in the secret store
+	Key string
+	// Property the property of the key in the secret store
+	Property string
+	// Status the kind of difference
+	Status Status
+	// StoreHash the keyed hash of the value in the secret store
+	StoreHash string
+	// ClusterHash the keyed hash of the value in the Kubernetes Secret
+	ClusterHash string
+}
+
+// NewCmdDiff creates a command object for the command
+func NewCmdDiff() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Short:   "Compares the values in the underlying secret storage with the Kubernetes Secrets",
+		Long:    cmdLong,
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "the namespace to filter the ExternalSecret resources")
+	cmd.Flags().BoolVarP(&o.ExitCode, "exit-code", "", false, "returns an error if there are any differences")
+	o.Options.AddFlags(cmd)
+	return cmd, o
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating options")
+	}
+
+	pairs, err := o.Load()
+	if err != nil {
+		return errors.Wrap(err, "failed to load ExternalSecret and Secret pairs")
+	}
+	o.hasher, err = masker.NewHasher()
+	if err != nil {
+		return err
+	}
+
+	o.Results = nil
+	for _, r := range pairs {
+		if !o.Matches(r) {
+			continue
+		}
+		if r.ExternalSecret.Annotations[extsecrets.ReplicaAnnotation] == "true" {
+			continue
+		}
+		results, err := o.diffSecret(r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to compare ExternalSecret %s", r.Key())
+		}
+		o.Results = append(o.Results, results...)
+	}
+
+	if len(o.Results) == 0 {
+		log.Logger().Infof("the secret store and the Kubernetes Secrets are in sync for %d ExternalSecrets", len(pairs))
+		return nil
+	}
+
+	t := table.CreateTable(os.Stdout)
+	t.AddRow("SECRET", "ENTRY", "DIFFERENCE", "STORE", "CLUSTER")
+	for _, d := range o.Results {
+		fullName := d.Name
+		if d.Namespace != "" && o.Namespace == "" {
+			fullName = d.Namespace + "/" + d.Name
+		}
+		t.AddRow(fullName, d.Entry, termcolor.ColorWarning(string(d.Status)), d.StoreHash, d.ClusterHash)
+	}
+	t.Render()
+
+	if o.ExitCode {
+		return errors.Errorf("found %d differences between the secret store and the Kubernetes Secrets", len(o.Results))
+	}
+	return nil
+}
+
+func (o *Options) diffSecret(r *secretfacade.SecretPair) ([]*Difference, error) {
+	es := &r.ExternalSecret
+	backendType := es.Spec.BackendType
+	secretManager, err := o.getSecretManager(backendType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a secret manager for backend type %s", backendType)
+	}
+	location := populate.GetExternalSecretLocation(es)
+
+	var answer []*Difference
+	for i := range es.Spec.Data {
+		d := &es.Spec.Data[i]
+		key := populate.GetSecretKey(v1alpha1.BackendType(backendType), es.Name, d.Key)
+		storeValue, err := secretManager.GetSecret(location, key, d.Property)
+		if err != nil {
+			if !editor.IsSecretNotFound(err) {
+				return nil, errors.Wrapf(err, "failed to get key %s property %s from the secret store", key, d.Property)
+			}
+			log.Logger().Debugf("key %s property %s is not in the secret store: %s", key, d.Property, err.Error())
+			storeValue = ""
+		}
+		clusterValue := ""
+		if r.Secret != nil {
+			clusterValue = string(r.Secret.Data[d.Name])
+		}
+
+		var status Status
+		switch {
+		case storeValue == "":
+			status = StatusMissingInStore
+		case clusterValue == "":
+			status = StatusStaleInCluster
+		case storeValue != clusterValue:
+			status = StatusDifferent
+		default:
+			continue
+		}
+		answer = append(answer, &Difference{
+			Namespace:   es.Namespace,
+			Name:        es.Name,
+			Entry:       d.Name,
+			Key:         key,
+			Property:    d.Property,
+			Status:      status,
+			StoreHash:   o.hasher.Hash(storeValue),
+			ClusterHash: o.hasher.Hash(clusterValue),
+		})
+	}
+	return answer, nil
+}
+
+func (o *Options) getSecretManager(backendType string) (secretstore.Interface, error) {
+	return o.secretManagers.Get(o.SecretStoreManagerFactory, o.KubeClient, backendType)
+}
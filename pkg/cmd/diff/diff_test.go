@@ -0,0 +1,134 @@
+package diff_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/diff"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	secretstorefake "github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiff(t *testing.T) {
+	var err error
+	ns := "jx"
+	location := "my-project"
+
+	kubeObjects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "jx-basic-auth",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"username": []byte("admin"),
+				"password": []byte("old-password"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "lighthouse-oauth-token",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"oauth": []byte("my-oauth-token"),
+				"hmac":  []byte("my-hmac-token"),
+			},
+		},
+	}
+
+	_, o := diff.NewCmdDiff()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset(kubeObjects...)
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	o.SecretStoreManagerFactory = fakeFactory
+	_, err = fakeFactory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	fakeStore := fakeFactory.GetSecretStore()
+	storeValues := map[string]map[string]string{
+		"jx-basic-auth": {
+			"username": "admin",
+			"password": "new-password",
+		},
+		"lighthouse-oauth-token": {
+			"token": "my-oauth-token",
+		},
+		"tekton-container-registry-auth": {
+			"dockerconfigjson": `{"auths":{}}`,
+		},
+	}
+	for k, v := range storeValues {
+		err = fakeStore.SetSecret(location, k, &secretstore.SecretValue{PropertyValues: v})
+		require.NoError(t, err)
+	}
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run diff")
+
+	results := map[string]*diff.Difference{}
+	for _, d := range o.Results {
+		results[d.Name+"/"+d.Entry] = d
+	}
+	require.Len(t, results, 3, "results")
+
+	d := results["jx-basic-auth/password"]
+	require.NotNil(t, d, "should have found a difference for jx-basic-auth/password")
+	assert.Equal(t, diff.StatusDifferent, d.Status, "status for %s", d.Name)
+	assert.NotEmpty(t, d.StoreHash, "store hash for %s", d.Name)
+	assert.NotEmpty(t, d.ClusterHash, "cluster hash for %s", d.Name)
+	assert.NotEqual(t, d.StoreHash, d.ClusterHash, "hashes of different values for %s", d.Name)
+	assert.NotContains(t, d.StoreHash, "new-password", "hash should not contain the value")
+
+	// the hashes use a random key so cannot be used to guess the values
+	sum := sha256.Sum256([]byte("new-password"))
+	assert.NotContains(t, d.StoreHash, hex.EncodeToString(sum[:])[:12], "hash should be keyed for %s", d.Name)
+
+	d = results["lighthouse-oauth-token/hmac"]
+	require.NotNil(t, d, "should have found a difference for lighthouse-oauth-token/hmac")
+	assert.Equal(t, diff.StatusMissingInStore, d.Status, "status for %s", d.Name)
+	assert.Empty(t, d.StoreHash, "store hash for %s", d.Name)
+
+	d = results["tekton-container-registry-auth/.dockerconfigjson"]
+	require.NotNil(t, d, "should have found a difference for tekton-container-registry-auth/.dockerconfigjson")
+	assert.Equal(t, diff.StatusStaleInCluster, d.Status, "status for %s", d.Name)
+	assert.Empty(t, d.ClusterHash, "cluster hash for %s", d.Name)
+
+	o.ExitCode = true
+	err = o.Run()
+	require.Error(t, err, "should fail with --exit-code when there are differences")
+}
+
+func TestDiffFailsOnSecretStoreError(t *testing.T) {
+	var err error
+	ns := "jx"
+
+	_, o := diff.NewCmdDiff()
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretStoreManagerFactory = &testsecrets.FailingSecretManagerFactory{Err: errors.New("permission denied")}
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	err = o.Run()
+	require.Error(t, err, "should fail to diff when the secret store fails")
+	assert.Contains(t, err.Error(), "permission denied", "error")
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2/terminal"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
 	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
 
@@ -17,6 +18,8 @@ import (
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor/factory"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/secretmapping"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
@@ -31,6 +34,20 @@ import (
 var (
 	cmdLong = templates.LongDesc(`
 		Edits secret values in the underlying secret stores for ExternalSecrets
+
+		The prompt for each property depends on the kind label of the property in the secret schema:
+
+		* confirm: a yes or no confirmation
+		* select: choose one of the options of the property
+		* multiline: edit the value in an editor, which is the default for properties with a certificate, key, JSON or YAML format
+		* text: a value which is shown as it is typed such as a user name
+		* file: the path of a file to read the value from
+		* password: a value which is hidden as it is typed, which is the default
+
+		Values are validated against the pattern, minimum length, maximum length and format of the property. If a value is not valid you are prompted again.
+
+		Use --from-literal or --from-file to set values without prompting. These values are validated in the same way.
+		Values must be of the form secret/entry=value unless the ExternalSecrets are filtered by name with --filter, --name or --name-regex.
 `)
 
 	cmdExample = templates.Examples(`
@@ -39,6 +56,12 @@ var (
 
 		# edit any secrets with a given filter
 		%s edit --filter nexus
+
+		# edit the secrets stored in vault whose names match a regular expression
+		%s edit --backend-type vault --name-regex '^lighthouse-.*'
+
+		# set secret values without prompting
+		%s edit --filter lighthouse --from-literal oauth=mytoken --from-file lighthouse-hmac-token/hmac=hmac.txt
 	`)
 )
 
@@ -51,11 +74,22 @@ type Options struct {
 	InteractiveSelectAll bool
 	ExternalVault        string
 	Input                input.Interface
+	EditText             EditTextFunc
+	FromLiterals         []string
+	FromFiles            []string
 	Results              []*secretfacade.SecretPair
 	CommandRunner        cmdrunner.CommandRunner
 	QuietCommandRunner   cmdrunner.CommandRunner
+	Audit                audit.Options
+
+	providedValues  map[string]string
+	providedSources map[string]audit.Source
+	auditor         *audit.Auditor
 }
 
+// maxPromptAttempts the number of times to prompt for a value which is not valid
+const maxPromptAttempts = 5
+
 // NewCmdEdit creates a command object for the command
 func NewCmdEdit() (*cobra.Command, *Options) {
 	o := &Options{}
@@ -64,7 +98,7 @@ func NewCmdEdit() (*cobra.Command, *Options) {
 		Use:     "edit",
 		Short:   "Edits secret values in the underlying secret stores for ExternalSecrets",
 		Long:    cmdLong,
-		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := o.Run()
 			helper.CheckErr(err)
@@ -76,6 +110,10 @@ func NewCmdEdit() (*cobra.Command, *Options) {
 	cmd.Flags().BoolVarP(&o.Interactive, "interactive", "i", false, "interactive mode asks the user for the Secret name and the properties to edit")
 	cmd.Flags().BoolVarP(&o.InteractiveMultiple, "multiple", "m", false, "for interactive mode do you want to select multiple secrets to edit. If not defaults to just picking a single secret")
 	cmd.Flags().BoolVarP(&o.InteractiveSelectAll, "all", "", false, "for interactive mode do you want to select all of the properties to edit by default. Otherwise none are selected and you choose to select the properties to change")
+	cmd.Flags().StringArrayVarP(&o.FromLiterals, "from-literal", "", nil, "the value of an entry of the form entry=value or secret/entry=value. If specified only these entries are edited without prompting")
+	cmd.Flags().StringArrayVarP(&o.FromFiles, "from-file", "", nil, "the file to read the value of an entry from of the form entry=path or secret/entry=path. If specified only these entries are edited without prompting")
+	o.SecretFilter.AddFlags(cmd)
+	o.Audit.AddFlags(cmd)
 	cmd.Flags().StringVarP(&o.ExternalVault, "external-vault", "", os.Getenv("EXTERNAL_VAULT"), "specify whether we are using external vault or not")
 	return cmd, o
 }
@@ -86,8 +124,21 @@ func (o *Options) Run() error {
 	if err != nil {
 		return errors.Wrap(err, "error validating options")
 	}
+	o.auditor, err = o.Audit.NewAuditor("edit", o.KubeClient)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the auditor")
+	}
+	err = o.loadProvidedValues()
+	if err != nil {
+		return errors.Wrap(err, "failed to load the values of the --from-literal and --from-file flags")
+	}
+	provided := len(o.providedValues) > 0
+	if provided && o.Interactive {
+		return errors.Errorf("cannot use --interactive with --from-literal or --from-file")
+	}
+
 	// it only makes sense to choose secrets from all namespaces when not having -f or -i., ie when you want to set all unset properties
-	if o.Namespace == "" && (o.Filter != "" || o.Interactive) {
+	if o.Namespace == "" && (o.hasFilters() || o.Interactive || provided) {
 		o.Namespace, err = kubeclient.CurrentNamespace()
 		if err != nil {
 			log.Logger().Warnf("failed to get current namespace, defaulting to all: %s", err.Error())
@@ -109,6 +160,13 @@ func (o *Options) Run() error {
 		o.Input = survey.NewInput()
 	}
 
+	if provided {
+		err = o.verifyProvidedValues(results)
+		if err != nil {
+			return err
+		}
+	}
+
 	if o.Interactive {
 		results, err = o.chooseSecrets(results)
 		if err != nil {
@@ -119,18 +177,25 @@ func (o *Options) Run() error {
 	for i := range results {
 		r := results[i]
 		name := r.ExternalSecret.Name
-		secEditor, err := factory.NewEditor(&r.ExternalSecret, o.SecretStoreManagerFactory, o.KubeClient, o.ExternalVault)
-		if err != nil {
-			return errors.Wrapf(err, "failed to create a secret editor for ExternalSecret %s", name)
-		}
 
 		// todo do we need to find any surveys that require a confirm?
 		// order them somehow?
 		// maybe skip any?
-		if o.Matches(r) {
-			data := o.DataToEdit(r)
+		var data []v1.Data
+		switch {
+		case provided:
+			data = o.providedData(r)
+		case o.Matches(r):
+			data = o.DataToEdit(r)
+		}
+		if len(data) > 0 {
+			secEditor, err := factory.NewEditor(&r.ExternalSecret, o.SecretStoreManagerFactory, o.KubeClient, o.ExternalVault)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create a secret editor for ExternalSecret %s", name)
+			}
 
 			m := map[string]*editor.KeyProperties{}
+			audits := map[string][]audit.Property{}
 			for i := range data {
 				d := &data[i]
 				key := populate.GetSecretKey(v1alpha1.BackendType(r.ExternalSecret.Spec.BackendType), name, d.Key)
@@ -162,14 +227,13 @@ func (o *Options) Run() error {
 					m[key] = keyProperties
 				}
 
-				// fix issue where strings with newlines were being escaped when being marshalled later, so let's ensure newlines are used
-				// see https://stackoverflow.com/questions/32042989/go-lang-differentiate-n-and-line-break
-				value = strings.Replace(value, `\n`, "\n", -1)
-
-				keyProperties.Properties = append(keyProperties.Properties, editor.PropertyValue{
+				pv := editor.PropertyValue{
 					Property: property,
+					Name:     d.Name,
 					Value:    value,
-				})
+				}
+				keyProperties.Properties = append(keyProperties.Properties, pv)
+				audits[key] = append(audits[key], o.auditor.Property(pv.PropertyName(), value, o.valueSource(r, d)))
 
 			}
 			for _, keyProperties := range m {
@@ -177,6 +241,17 @@ func (o *Options) Run() error {
 				if err != nil {
 					return errors.Wrapf(err, "failed to save properties %s on ExternalSecret %s", keyProperties.String(), name)
 				}
+				err = o.auditor.Record(&audit.Event{
+					Namespace:      r.Namespace(),
+					ExternalSecret: name,
+					Backend:        r.ExternalSecret.Spec.BackendType,
+					Location:       populate.GetExternalSecretLocation(&r.ExternalSecret),
+					Key:            keyProperties.Key,
+					Properties:     audits[keyProperties.Key],
+				})
+				if err != nil {
+					log.Logger().Warnf("%s", err.Error())
+				}
 			}
 		}
 	}
@@ -232,37 +307,59 @@ func (o *Options) askForSecretValue(s *secretfacade.SecretPair, d *v1.Data) (str
 		return "", errors.Wrapf(err, "failed to find object schema for object %s property %s", name, property)
 	}
 	propertySpec := object.FindProperty(d.Name)
+
+	if providedValue, ok := o.providedValue(s, d); ok {
+		message, err := invalidValueMessage(name, propertySpec, providedValue) //nolint:govet
+		if err != nil {
+			return "", err
+		}
+		if message != "" {
+			return "", errors.New(message)
+		}
+		return providedValue, nil
+	}
+
 	if propertySpec == nil {
 		message, help := o.propertyMessage(s, d)
 		value, err = o.Input.PickPassword(message, help) //nolint:govet
 		if err != nil {
 			return "", errors.Wrapf(err, "failed to enter property %s for key %s on ExternalSecret %s", property, d.Key, name)
 		}
-		return value, nil
+		return unescapeNewLines(value), nil
 	}
 
-	// if mask
-
-	// if format
-
-	// if pattern?
-
-	// min / max
-
-	// if confirm
-
-	// if git get the kind URL / template the help and question?
-
-	// Add TESTS!!!
+	for attempt := 1; ; attempt++ {
+		value, err = o.askForPropertyValue(s, d, propertySpec)
+		if err != nil {
+			return "", err
+		}
+		message, err := invalidValueMessage(name, propertySpec, value)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			return value, nil
+		}
+		if attempt >= maxPromptAttempts {
+			return "", errors.New(message)
+		}
+		log.Logger().Warnf("%s: please try again", message)
+	}
+}
 
-	kind := propertySpec.Labels[schemaapi.LabelKind]
-	switch kind {
-	case "confirm":
-		log.Logger().Warn("implement confirm")
-	default:
-		return o.Input.PickPassword(propertySpec.Question, propertySpec.Help) //nolint:govet
+// invalidValueMessage returns a message describing why a value does not match the property schema or a blank string if it is valid
+func invalidValueMessage(name string, propertySpec *schemaapi.Property, value string) (string, error) {
+	if propertySpec == nil {
+		return "", nil
 	}
-	return value, nil
+	messages, err := schemas.ValidatePropertyValue(propertySpec, value)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to validate property %s on ExternalSecret %s", propertySpec.Name, name)
+	}
+	if len(messages) > 0 {
+		return fmt.Sprintf("the value of property %s on ExternalSecret %s %s", propertySpec.Name, name, strings.Join(messages, ", ")), nil
+	}
+	return "", nil
 }
 
 func (o *Options) propertyMessage(s *secretfacade.SecretPair, d *v1.Data) (string, string) {
@@ -274,16 +371,24 @@ func (o *Options) propertyMessage(s *secretfacade.SecretPair, d *v1.Data) (strin
 	return name + "." + property, ""
 }
 
-// Matches returns true if the secret matches the current filter
-// If no filter then just filter out mandatory properties only?
+// Matches returns true if the secret matches the current filters
+// If no filters then just filter out mandatory properties only?
 func (o *Options) Matches(r *secretfacade.SecretPair) bool {
-	if o.Filter == "" {
+	if !o.hasFilters() {
 		if o.Interactive {
 			return true
 		}
 		return r.IsInvalid()
 	}
-	return strings.Contains(r.ExternalSecret.Name, o.Filter)
+	if o.Filter != "" && !strings.Contains(r.ExternalSecret.Name, o.Filter) {
+		return false
+	}
+	return o.SecretFilter.Matches(r)
+}
+
+// hasFilters returns true if the name filter or any of the secret filters are specified
+func (o *Options) hasFilters() bool {
+	return o.Filter != "" || !o.SecretFilter.IsEmpty()
 }
 
 // DataToEdit returns the properties to edit
@@ -311,9 +416,14 @@ func (o *Options) DataToEdit(r *secretfacade.SecretPair) []v1.Data {
 		return answer
 	}
 
-	// if filtering return all properties
-	if o.Filter != "" {
-		return r.ExternalSecret.Spec.Data
+	// if filtering return all the required properties
+	if o.hasFilters() {
+		data, err := o.RequiredData(r)
+		if err != nil {
+			log.Logger().Warnf("failed to find the required data entries: %s", err.Error())
+			return r.ExternalSecret.Spec.Data
+		}
+		return data
 	}
 
 	missingProperties := map[string]bool{}
@@ -341,6 +451,11 @@ func (o *Options) VerifyAndFilter() ([]*secretfacade.SecretPair, error) {
 		return secrets, err
 	}
 
+	secretMapping, _, err := secretmapping.LoadSecretMapping(o.Dir, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load secret mappings in dir %s", o.Dir)
+	}
+
 	// let's filter out any secrets with same locations...
 	destinations := map[string][]*secretfacade.SecretPair{}
 
@@ -358,7 +473,7 @@ func (o *Options) VerifyAndFilter() ([]*secretfacade.SecretPair, error) {
 			continue
 		}
 
-		secretfacade.SortSecretsInSchemaOrder(secretsForDestination)
+		secretfacade.SortSecretsInCanonicalOrder(secretsForDestination, secretMapping)
 		for i := 1; i < len(secretsForDestination); i++ {
 			key := secretsForDestination[i].Key()
 			if !filterKeys[key] {
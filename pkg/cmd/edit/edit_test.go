@@ -2,15 +2,20 @@ package edit_test
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/edit"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner/fakerunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
 	fakeinput "github.com/jenkins-x/jx-helpers/v3/pkg/input/fake"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -76,3 +81,201 @@ func TestEditLocal(t *testing.T) {
 	secret, message = testhelpers.RequireSecretExists(t, o.KubeClient, ns, "lighthouse-oauth-token")
 	testhelpers.AssertSecretEntryEquals(t, secret, "token", expectedPipelineToken, message)
 }
+
+func TestEditPropertyKinds(t *testing.T) {
+	_, o := edit.NewCmdEdit()
+	ns := "jx"
+
+	o.Namespace = ns
+	o.Filter = "my-config"
+	o.KubeClient = fake.NewSimpleClientset()
+
+	var err error
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, filepath.Join("test_data", "kinds"))
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	runner := &fakerunner.FakeRunner{}
+	o.CommandRunner = runner.Run
+
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	const expectedCert = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	err = os.WriteFile(certFile, []byte(expectedCert), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to write file %s", certFile)
+
+	const expectedConfig = "{\n  \"a\": \"b\\nc\"\n}\n"
+	o.EditText = func(message, defaultValue, help string) (string, error) {
+		assert.Equal(t, "Enter the config", message, "editor message")
+		return expectedConfig, nil
+	}
+	o.Input = &fakeinput.FakeInput{
+		Values: map[string]string{
+			"Enable the feature?":               "yes",
+			"Enter the path to the certificate": certFile,
+			"Enter the token":                   "my-token",
+		},
+	}
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run edit")
+
+	secret, message := testhelpers.RequireSecretExists(t, o.KubeClient, ns, "my-config")
+	testhelpers.AssertSecretEntryEquals(t, secret, "enabled", "true", message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "provider", "gitlab", message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "config", expectedConfig, message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "username", "admin", message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "cert", expectedCert, message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "token", "my-token", message)
+}
+
+func newValidateEditOptions(t *testing.T) *edit.Options {
+	_, o := edit.NewCmdEdit()
+	ns := "jx"
+
+	o.Namespace = ns
+	o.Filter = "my-token"
+	o.KubeClient = fake.NewSimpleClientset()
+
+	var err error
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, filepath.Join("test_data", "validate"))
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	runner := &fakerunner.FakeRunner{}
+	o.CommandRunner = runner.Run
+	return o
+}
+
+func TestEditRepromptsInvalidValues(t *testing.T) {
+	o := newValidateEditOptions(t)
+	input := &fakeinput.FakeInput{
+		OrderedValues: []string{"short", "NOT-VALID-TOKEN", "abcdef0123", "github.com", "https://github.com"},
+	}
+	o.Input = input
+
+	err := o.Run()
+	require.NoError(t, err, "failed to run edit")
+	assert.Equal(t, 5, input.Counter, "number of prompts")
+
+	secret, message := testhelpers.RequireSecretExists(t, o.KubeClient, "jx", "my-token")
+	testhelpers.AssertSecretEntryEquals(t, secret, "token", "abcdef0123", message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "url", "https://github.com", message)
+
+	o = newValidateEditOptions(t)
+	o.Input = &fakeinput.FakeInput{
+		Values: map[string]string{
+			"Enter the token": "abc",
+		},
+	}
+	err = o.Run()
+	require.Error(t, err, "should fail after too many invalid values")
+	assert.NotContains(t, err.Error(), "abc", "the error should not contain the value")
+}
+
+func TestEditFromLiteralAndFile(t *testing.T) {
+	o := newValidateEditOptions(t)
+
+	urlFile := filepath.Join(t.TempDir(), "url.txt")
+	err := os.WriteFile(urlFile, []byte("https://github.com/jenkins-x"), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to write file %s", urlFile)
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	o.FromLiterals = []string{"my-token/token=abcdef0123"}
+	o.FromFiles = []string{"url=" + urlFile}
+	o.Input = &fakeinput.FakeInput{}
+	o.Audit.File = auditFile
+	o.Audit.Events = true
+	o.Audit.User = "test-user"
+	o.Audit.HashKey = "my-key"
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run edit")
+
+	secret, message := testhelpers.RequireSecretExists(t, o.KubeClient, "jx", "my-token")
+	testhelpers.AssertSecretEntryEquals(t, secret, "token", "abcdef0123", message)
+	testhelpers.AssertSecretEntryEquals(t, secret, "url", "https://github.com/jenkins-x", message)
+
+	// lets verify the write was audited without the values
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err, "failed to read audit log %s", auditFile)
+	assert.NotContains(t, string(data), "abcdef0123", "the audit log should not contain the value")
+	e := &audit.Event{}
+	err = json.Unmarshal(data, e)
+	require.NoError(t, err, "failed to parse audit log %s", auditFile)
+	assert.Equal(t, "test-user", e.User, "user")
+	assert.Equal(t, "jx-secret edit", e.Command, "command")
+	assert.Equal(t, "jx", e.Namespace, "namespace")
+	assert.Equal(t, "my-token", e.ExternalSecret, "externalSecret")
+	assert.Equal(t, []audit.Property{
+		{Name: "token", Source: audit.SourceLiteral, Hash: audit.HashValue("abcdef0123", []byte("my-key"))},
+		{Name: "url", Source: audit.SourceFile, Hash: audit.HashValue("https://github.com/jenkins-x", []byte("my-key"))},
+	}, e.Properties, "properties")
+
+	events, err := o.KubeClient.CoreV1().Events("jx").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err, "failed to list Events")
+	require.Len(t, events.Items, 1, "audit Events")
+	assert.Equal(t, audit.EventReason, events.Items[0].Reason, "reason")
+	assert.Equal(t, "my-token", events.Items[0].InvolvedObject.Name, "involved object")
+
+	o = newValidateEditOptions(t)
+	o.FromLiterals = []string{"token=short"}
+	o.Input = &fakeinput.FakeInput{}
+	err = o.Run()
+	require.Error(t, err, "should fail for an invalid literal value")
+	t.Logf("got expected error: %s", err.Error())
+
+	o = newValidateEditOptions(t)
+	o.FromLiterals = []string{"cheese=abcdef0123"}
+	o.Input = &fakeinput.FakeInput{}
+	err = o.Run()
+	require.Error(t, err, "should fail for an unknown entry")
+	assert.Contains(t, err.Error(), "cheese", "error message")
+
+	o = newValidateEditOptions(t)
+	o.FromLiterals = []string{"my-token/token="}
+	o.Input = &fakeinput.FakeInput{}
+	err = o.Run()
+	require.Error(t, err, "should fail for an empty literal value which is not valid")
+	assert.Contains(t, err.Error(), "minimum length", "error message")
+
+	o = newValidateEditOptions(t)
+	o.Filter = ""
+	o.FromLiterals = []string{"token=abcdef0123"}
+	o.Input = &fakeinput.FakeInput{}
+	err = o.Run()
+	require.Error(t, err, "should fail for an entry without a secret name or name filter")
+	assert.Contains(t, err.Error(), "secret/entry", "error message")
+}
+
+func TestEditAuditsEntriesWithoutProperty(t *testing.T) {
+	_, o := edit.NewCmdEdit()
+	ns := "jx"
+
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset()
+	o.Input = &fakeinput.FakeInput{}
+	o.FromLiterals = []string{"my-api-key/apiKey=abcdef0123"}
+
+	var err error
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, filepath.Join("test_data", "noproperty"))
+	o.SecretClient, err = extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...))
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	o.Audit.File = auditFile
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run edit")
+
+	secret, message := testhelpers.RequireSecretExists(t, o.KubeClient, ns, "my-api-key")
+	testhelpers.AssertSecretEntryEquals(t, secret, "apiKey", "abcdef0123", message)
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err, "failed to read audit log %s", auditFile)
+	e := &audit.Event{}
+	err = json.Unmarshal(data, e)
+	require.NoError(t, err, "failed to parse audit log %s", auditFile)
+	assert.Equal(t, []string{"apiKey"}, e.PropertyNames(), "the entry name should be audited when there is no property")
+}
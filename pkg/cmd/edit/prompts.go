@@ -0,0 +1,130 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	schemaapi "github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/homedir"
+	"github.com/pkg/errors"
+)
+
+// multiLineFormats the formats which default to being edited in an editor
+var multiLineFormats = map[string]bool{
+	"json":             true,
+	"yaml":             true,
+	"pem-certificate":  true,
+	"pem-private-key":  true,
+	"dockerconfigjson": true,
+	"htpasswd":         true,
+	"ssh-private-key":  true,
+}
+
+// EditTextFunc edits multi-line text returning the new text
+type EditTextFunc func(message, defaultValue, help string) (string, error)
+
+// SurveyEditText edits multi-line text in the users editor
+func SurveyEditText(message, defaultValue, help string) (string, error) {
+	answer := ""
+	prompt := &survey.Editor{
+		Message:       message,
+		Default:       defaultValue,
+		Help:          help,
+		AppendDefault: true,
+		HideDefault:   true,
+	}
+	err := survey.AskOne(prompt, &answer)
+	return answer, err
+}
+
+// PropertyKind returns the kind of prompt to use for the property from its kind label.
+// If there is no label then properties with options are selected, properties with a multi-line format
+// are edited in an editor and all other properties are treated as passwords
+func PropertyKind(propertySpec *schemaapi.Property) string {
+	kind := propertySpec.Labels[schemaapi.LabelKind]
+	if kind != "" {
+		return kind
+	}
+	if len(propertySpec.Options) > 0 {
+		return schemaapi.KindSelect
+	}
+	if multiLineFormats[propertySpec.Format] {
+		return schemaapi.KindMultiLine
+	}
+	return schemaapi.KindPassword
+}
+
+// askForPropertyValue prompts for the value of the property using the prompt for its kind
+func (o *Options) askForPropertyValue(s *secretfacade.SecretPair, d *v1.Data, propertySpec *schemaapi.Property) (string, error) {
+	message := propertySpec.Question
+	help := propertySpec.Help
+	if message == "" {
+		message, help = o.propertyMessage(s, d)
+	}
+	defaultValue := propertySpec.DefaultValue
+
+	kind := PropertyKind(propertySpec)
+	switch kind {
+	case schemaapi.KindConfirm:
+		answer, err := o.Input.Confirm(message, defaultValue == "true", help)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(answer), nil
+
+	case schemaapi.KindSelect:
+		if len(propertySpec.Options) == 0 {
+			return "", errors.Errorf("property %s has kind %s but no options", propertySpec.Name, kind)
+		}
+		return o.Input.PickNameWithDefault(propertySpec.Options, message, defaultValue, help)
+
+	case schemaapi.KindMultiLine:
+		if o.EditText == nil {
+			o.EditText = SurveyEditText
+		}
+		return o.EditText(message, defaultValue, help)
+
+	case schemaapi.KindText:
+		value, err := o.Input.PickValue(message, defaultValue, true, help)
+		return unescapeNewLines(value), err
+
+	case schemaapi.KindFile:
+		path, err := o.Input.PickValue(message, defaultValue, true, help)
+		if err != nil {
+			return "", err
+		}
+		path = strings.TrimSpace(path)
+		if strings.HasPrefix(path, "~/") {
+			path = filepath.Join(homedir.HomeDir(), path[2:])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read file %s", path)
+		}
+		return string(data), nil
+
+	case schemaapi.KindPassword:
+		value, err := o.Input.PickPassword(message, help)
+		if err != nil {
+			return "", err
+		}
+		if value == "" {
+			value = defaultValue
+		}
+		return unescapeNewLines(value), nil
+
+	default:
+		return "", errors.Errorf("unknown kind %s for property %s", kind, propertySpec.Name)
+	}
+}
+
+// unescapeNewLines fixes issue where strings with newlines were being escaped when being marshalled later, so let's ensure newlines are used
+// see https://stackoverflow.com/questions/32042989/go-lang-differentiate-n-and-line-break
+func unescapeNewLines(value string) string {
+	return strings.ReplaceAll(value, `\n`, "\n")
+}
@@ -0,0 +1,127 @@
+package edit
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/pkg/errors"
+)
+
+// loadProvidedValues loads the values of the --from-literal and --from-file flags indexed by entry name
+func (o *Options) loadProvidedValues() error {
+	o.providedValues = map[string]string{}
+	o.providedSources = map[string]audit.Source{}
+	for _, text := range o.FromLiterals {
+		key, value, err := splitKeyValue(text, "from-literal")
+		if err != nil {
+			return err
+		}
+		o.providedValues[key] = value
+		o.providedSources[key] = audit.SourceLiteral
+	}
+	for _, text := range o.FromFiles {
+		key, path, err := splitKeyValue(text, "from-file")
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read file %s for entry %s", path, key)
+		}
+		o.providedValues[key] = string(data)
+		o.providedSources[key] = audit.SourceFile
+	}
+
+	// an entry name on its own could match an entry in every ExternalSecret in the namespace
+	if !o.hasNameFilter() {
+		for key := range o.providedValues {
+			if !strings.Contains(key, "/") {
+				return errors.Errorf("the value for entry %s must use the form secret/entry unless --filter, --name or --name-regex is specified", key)
+			}
+		}
+	}
+	return nil
+}
+
+// hasNameFilter returns true if the ExternalSecrets are filtered by name
+func (o *Options) hasNameFilter() bool {
+	return o.Filter != "" || len(o.SecretFilter.Names) > 0 || o.SecretFilter.NameRegex != ""
+}
+
+// splitKeyValue splits the flag value into the entry name and the value.
+// The error never includes the text as it may contain a secret value
+func splitKeyValue(text, flag string) (string, string, error) {
+	key, value, found := strings.Cut(text, "=")
+	if !found || key == "" {
+		return "", "", errors.Errorf("invalid --%s flag: should be of the form entry=value or secret/entry=value", flag)
+	}
+	return key, value, nil
+}
+
+// providedValue returns the value for the entry from the --from-literal or --from-file flags if there is one.
+// A value for a specific ExternalSecret using secret/entry takes precedence over a value for the entry of any
+// secret which matches the filters
+func (o *Options) providedValue(s *secretfacade.SecretPair, d *v1.Data) (string, bool) {
+	value, ok := o.providedValues[s.Name()+"/"+d.Name]
+	if ok {
+		return value, true
+	}
+	if !o.Matches(s) {
+		return "", false
+	}
+	value, ok = o.providedValues[d.Name]
+	return value, ok
+}
+
+// valueSource returns the audit source of the value of the entry
+func (o *Options) valueSource(s *secretfacade.SecretPair, d *v1.Data) audit.Source {
+	for _, key := range []string{s.Name() + "/" + d.Name, d.Name} {
+		source, ok := o.providedSources[key]
+		if ok {
+			return source
+		}
+	}
+	return audit.SourceUser
+}
+
+// providedData returns the data entries of the secret which have values from the --from-literal or --from-file flags
+func (o *Options) providedData(s *secretfacade.SecretPair) []v1.Data {
+	var answer []v1.Data
+	for i := range s.ExternalSecret.Spec.Data {
+		d := &s.ExternalSecret.Spec.Data[i]
+		if _, ok := o.providedValue(s, d); ok {
+			answer = append(answer, *d)
+		}
+	}
+	return answer
+}
+
+// verifyProvidedValues returns an error if any of the provided values do not match an entry in the secrets
+func (o *Options) verifyProvidedValues(secrets []*secretfacade.SecretPair) error {
+	found := map[string]bool{}
+	for _, s := range secrets {
+		matches := o.Matches(s)
+		for i := range s.ExternalSecret.Spec.Data {
+			d := &s.ExternalSecret.Spec.Data[i]
+			found[s.Name()+"/"+d.Name] = true
+			if matches {
+				found[d.Name] = true
+			}
+		}
+	}
+	var missing []string
+	for key := range o.providedValues {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("no ExternalSecret entries found for %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
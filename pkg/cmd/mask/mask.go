@@ -0,0 +1,283 @@
+package mask
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker/watcher"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	info = termcolor.ColorInfo
+
+	cmdLong = templates.LongDesc(`
+		Masks the values of Secrets in text
+
+		If no files are specified then stdin is masked to stdout. Otherwise the files (or all files inside the directories) are masked in place.
+
+		Use --check to fail if any of the files contain unmasked secret values without modifying them.
+`)
+
+	cmdExample = templates.Examples(`
+		# mask the output of a command
+		some-command | %s mask
+
+		# mask log files in place
+		%s mask build.log test-report.xml
+
+		# fail if any files in the directory contain secret values
+		%s mask --check target/reports
+	`)
+)
+
+// Options the options for the command
+type Options struct {
+	Namespaces []string
+	Files      []string
+	Check      bool
+	Watch      bool
+	KubeClient kubernetes.Interface
+	In         io.Reader
+	Out        io.Writer
+
+	// Findings the locations of unmasked secret values found in check mode
+	Findings []*Finding
+
+	maskClient func() *masker.Client
+	stop       chan struct{}
+}
+
+// Finding the location of an unmasked secret value
+type Finding struct {
+	// File the name of the file
+	File string
+	// Line the 1 based line number
+	Line int
+}
+
+// NewCmdMask creates a command object for the command
+func NewCmdMask() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "mask [files or directories]",
+		Short:   "Masks the values of Secrets in stdin or the given files",
+		Long:    cmdLong,
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
+		Run: func(cmd *cobra.Command, args []string) {
+			o.Files = args
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&o.Namespaces, "ns", "n", nil, "one or more namespaces to load the Secrets from. Defaults to the current namespace")
+	cmd.Flags().BoolVarP(&o.Check, "check", "c", false, "checks the files for unmasked secret values and fails if any are found rather than masking them")
+	cmd.Flags().BoolVarP(&o.Watch, "watch", "w", false, "watches the Secrets while masking stdin so that new or changed values are masked too")
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if o.In == nil {
+		o.In = os.Stdin
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.Check && len(o.Files) == 0 {
+		return options.MissingOption("files")
+	}
+	if o.maskClient != nil {
+		return nil
+	}
+
+	var err error
+	ns := ""
+	if len(o.Namespaces) > 0 {
+		ns = o.Namespaces[0]
+	}
+	o.KubeClient, ns, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, ns)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create kube client")
+	}
+	if len(o.Namespaces) == 0 {
+		o.Namespaces = []string{ns}
+	}
+
+	if o.Watch {
+		w := &watcher.Options{
+			Namespaces: o.Namespaces,
+			KubeClient: o.KubeClient,
+		}
+		o.stop = make(chan struct{})
+		err = w.RunWithChannel(o.stop)
+		if err != nil {
+			return errors.Wrapf(err, "failed to start the secret watcher")
+		}
+		if !w.WaitForSync(o.stop) {
+			return errors.Errorf("failed to load the Secrets in namespaces %s", strings.Join(o.Namespaces, ", "))
+		}
+		o.maskClient = w.GetClient
+		return nil
+	}
+
+	client := &masker.Client{
+		LogFn: func(text string) {
+			log.Logger().Debug(text)
+		},
+	}
+	for _, ns := range o.Namespaces {
+		err = client.LoadSecrets(o.KubeClient, ns)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load Secrets from namespace %s", ns)
+		}
+	}
+	client.Compile()
+	o.maskClient = func() *masker.Client {
+		return client
+	}
+	return nil
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	defer o.stopWatching()
+	if err != nil {
+		return errors.Wrapf(err, "failed to validate options")
+	}
+
+	if len(o.Files) == 0 {
+		return o.MaskStream(o.In, o.Out)
+	}
+
+	o.Findings = nil
+	for _, path := range o.Files {
+		err = filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			if o.Check {
+				return o.checkFile(path)
+			}
+			return o.maskFile(path, fi.Mode())
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to process %s", path)
+		}
+	}
+	if len(o.Findings) > 0 {
+		return errors.Errorf("found %d unmasked secret values", len(o.Findings))
+	}
+	return nil
+}
+
+// stopWatching stops the secret watcher if one was started
+func (o *Options) stopWatching() {
+	if o.stop != nil {
+		close(o.stop)
+		o.stop = nil
+	}
+}
+
+// MaskStream masks the reader to the writer a line at a time holding back enough lines to mask multi line values
+func (o *Options) MaskStream(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	var pending []string
+	write := func(lines []string) error {
+		for _, l := range lines {
+			_, err := io.WriteString(out, l)
+			if err != nil {
+				return errors.Wrap(err, "failed to write masked output")
+			}
+		}
+		return nil
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			// lets mask the held back lines with the new line in case a value spans them
+			client := o.maskClient()
+			pending = splitLines(client.Mask(strings.Join(append(pending, line), "")))
+			count := len(pending) - (client.MaxLines() - 1)
+			if count > 0 {
+				werr := write(pending[:count])
+				if werr != nil {
+					return werr
+				}
+				pending = pending[count:]
+			}
+		}
+		if err == io.EOF {
+			return write(pending)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read input")
+		}
+	}
+}
+
+// splitLines splits the text into lines keeping their line endings
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func (o *Options) maskFile(path string, mode os.FileMode) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read file %s", path)
+	}
+	text := string(data)
+	masked := o.maskClient().Mask(text)
+	if masked == text {
+		return nil
+	}
+	err = os.WriteFile(path, []byte(masked), mode)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", path)
+	}
+	log.Logger().Infof("masked secret values in file %s", info(path))
+	return nil
+}
+
+func (o *Options) checkFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read file %s", path)
+	}
+	// lets check the whole content so that multi line values like PEM keys are found
+	text := string(data)
+	lastLine := 0
+	for _, offset := range o.maskClient().Indexes(text) {
+		line := strings.Count(text[:offset], "\n") + 1
+		if line == lastLine {
+			continue
+		}
+		lastLine = line
+		o.Findings = append(o.Findings, &Finding{File: path, Line: line})
+		log.Logger().Warnf("file %s line %d contains an unmasked secret value", path, line)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package populate
+
+import (
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// destination a key in a secret store which is written once with the merged properties of all the ExternalSecrets using it.
+//
+// Back ends like vault replace all the properties of a key on each write so writing each ExternalSecret separately
+// could lose the properties of the other ExternalSecrets
+type destination struct {
+	backendType   string
+	location      string
+	key           string
+	secretManager secretstore.Interface
+
+	// source the first ExternalSecret using the destination whose metadata is used for local secrets
+	source *secretfacade.SecretPair
+
+	properties []*destinationProperty
+	changed    bool
+}
+
+// destinationProperty a property value of a destination and the ExternalSecret which provided it
+type destinationProperty struct {
+	editor.PropertyValue
+
+	// newValue the value is a new value rather than the current value
+	newValue bool
+
+	// source the ExternalSecret which provided the value
+	source *secretfacade.SecretPair
+
+	// auditSource where the value came from
+	auditSource audit.Source
+}
+
+// destinations the destinations in the order they were found
+type destinations struct {
+	items []*destination
+}
+
+// get returns the destination for the key creating it if it does not exist
+func (d *destinations) get(backendType, location, key string) *destination {
+	for _, dest := range d.items {
+		if dest.backendType == backendType && dest.location == location && dest.key == key {
+			return dest
+		}
+	}
+	dest := &destination{
+		backendType: backendType,
+		location:    location,
+		key:         key,
+	}
+	d.items = append(d.items, dest)
+	return dest
+}
+
+// value returns the current or new value of the property
+func (d *destination) value(property, name string) string {
+	p := d.find(propertyName(property, name))
+	if p == nil {
+		return ""
+	}
+	return p.Value
+}
+
+// find returns the property with the given property name
+func (d *destination) find(name string) *destinationProperty {
+	for _, p := range d.properties {
+		if p.PropertyName() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// propertyName returns the name of the property in the secret store which defaults to the entry name if there is no property
+func propertyName(property, name string) string {
+	pv := editor.PropertyValue{Property: property, Name: name}
+	return pv.PropertyName()
+}
+
+// setValue merges the value of the property from the given ExternalSecret.
+// Returns an error if another ExternalSecret has a different new value for the property
+func (d *destination) setValue(s *secretfacade.SecretPair, property, name, value string, auditSource audit.Source, newValue bool) error {
+	p := d.find(propertyName(property, name))
+	if p == nil {
+		d.properties = append(d.properties, &destinationProperty{
+			PropertyValue: editor.PropertyValue{
+				Property: property,
+				Name:     name,
+				Value:    value,
+			},
+			newValue:    newValue,
+			source:      s,
+			auditSource: auditSource,
+		})
+		return nil
+	}
+	if !newValue {
+		if p.Value == "" {
+			p.Value = value
+			p.source = s
+			p.auditSource = auditSource
+		}
+		return nil
+	}
+	if p.newValue && p.source.Key() != s.Key() && p.Value != value {
+		return errors.Errorf("the ExternalSecrets %s and %s have different values for property %s of key %s", p.source.Key(), s.Key(), p.PropertyName(), d.key)
+	}
+	p.Value = value
+	p.newValue = true
+	p.source = s
+	p.auditSource = auditSource
+	return nil
+}
+
+// propertyValues returns the property values to write ignoring blank values so they do not replace the values in the store
+func (d *destination) propertyValues() []editor.PropertyValue {
+	var values []editor.PropertyValue
+	for _, p := range d.properties {
+		if p.Value == "" {
+			continue
+		}
+		values = append(values, p.PropertyValue)
+	}
+	return values
+}
+
+// propertyNames returns the names of all the properties of the ExternalSecrets using the destination
+// so that the current values of the properties which are not written are read back from stores without versions
+func (d *destination) propertyNames() []string {
+	var names []string
+	for _, p := range d.properties {
+		names = append(names, p.PropertyName())
+	}
+	return names
+}
+
+// secretValue creates the secret value to write from the merged property values
+func (d *destination) secretValue(values []editor.PropertyValue) secretstore.SecretValue {
+	es := &d.source.ExternalSecret
+	annotations := map[string]string{}
+	for k, v := range es.Spec.Template.Metadata.Annotations {
+		annotations[k] = v
+	}
+
+	// handle replicate to annotation for local secrets so that we also copy the secret to other namespaces
+	replicateTo := ""
+	if es.Annotations != nil {
+		replicateTo = es.Annotations[extsecrets.ReplicateToAnnotation]
+	}
+	if replicateTo != "" {
+		annotations[extsecrets.ReplicateToAnnotation] = replicateTo
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	labels := es.Spec.Template.Metadata.Labels
+	secretType := corev1.SecretType(es.Spec.Template.Type)
+	return CreateSecretValue(v1alpha1.BackendType(d.backendType), values, annotations, labels, secretType)
+}
+
+// auditEvents creates the audit events for writing the destination with an event for each ExternalSecret which provided a new value.
+// If there are no new values such as when writing local replicas all the values are audited against the first ExternalSecret
+func (d *destination) auditEvents(a *audit.Auditor) []*audit.Event {
+	var answer []*audit.Event
+	m := map[*secretfacade.SecretPair]*audit.Event{}
+	for _, p := range d.properties {
+		if !p.newValue {
+			continue
+		}
+		e := m[p.source]
+		if e == nil {
+			e = d.auditEvent(p.source)
+			m[p.source] = e
+			answer = append(answer, e)
+		}
+		e.Properties = append(e.Properties, a.Property(p.PropertyName(), p.Value, p.auditSource))
+	}
+	if len(answer) > 0 {
+		return answer
+	}
+	e := d.auditEvent(d.source)
+	for _, p := range d.properties {
+		e.Properties = append(e.Properties, a.Property(p.PropertyName(), p.Value, p.auditSource))
+	}
+	return []*audit.Event{e}
+}
+
+func (d *destination) auditEvent(s *secretfacade.SecretPair) *audit.Event {
+	return &audit.Event{
+		Namespace:      s.Namespace(),
+		ExternalSecret: s.Name(),
+		Backend:        d.backendType,
+		Location:       d.location,
+		Key:            d.key,
+	}
+}
@@ -14,16 +14,19 @@ import (
 
 	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/vault/wait"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/formats"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/generators"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/vaults"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/vaults/vaultcli"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/vaults/vaultstore"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
-	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/factory"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
@@ -32,6 +35,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 )
 
 var (
@@ -40,7 +44,11 @@ var (
 `)
 
 	cmdExample = templates.Examples(`
+		# populate all the secrets
 		%s populate
+
+		# populate the secrets with a label
+		%s populate --selector app=lighthouse
 	`)
 
 	DefaultBackoff = k8swait.Backoff{
@@ -64,9 +72,11 @@ type Options struct {
 	DisableLoadResults  bool
 	Generators          map[string]generators.Generator
 	HelmSecretValues    map[string]map[string]string
-	Requirements        *jxcore.RequirementsConfig
 	BootSecretNamespace string
 	DisableSecretFolder bool
+	Audit               audit.Options
+
+	auditor *audit.Auditor
 }
 
 // NewCmdPopulate creates a command object for the command
@@ -77,7 +87,7 @@ func NewCmdPopulate() (*cobra.Command, *Options) {
 		Use:     "populate",
 		Short:   "Populates any missing secret values which can be automatically generated, generated using a template or that have default values",
 		Long:    cmdLong,
-		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName),
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return o.Run()
 		},
@@ -91,6 +101,7 @@ func NewCmdPopulate() (*cobra.Command, *Options) {
 	cmd.Flags().StringVarP(&o.SecretNamespace, "secret-namespace", "", vaults.DefaultVaultNamespace, "the namespace in which secret infrastructure resides such as Hashicorp Vault")
 
 	o.Options.AddFlags(cmd)
+	o.Audit.AddFlags(cmd)
 	return cmd, o
 }
 
@@ -108,6 +119,10 @@ func (o *Options) Validate() error {
 	if o.Backoff == nil {
 		o.Backoff = &DefaultBackoff
 	}
+	o.auditor, err = o.Audit.NewAuditor("populate", o.KubeClient)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the auditor")
+	}
 	return nil
 }
 
@@ -125,7 +140,7 @@ func (o *Options) Run() error {
 		if err != nil {
 			return errors.Wrap(err, "failed to verify secrets")
 		}
-		o.Results = results
+		o.Results = o.matching(results)
 	}
 
 	results := o.Results
@@ -147,6 +162,7 @@ func (o *Options) Run() error {
 	if err != nil {
 		return errors.Wrap(err, "failed to verify secrets on second pass")
 	}
+	results = o.matching(results)
 	o.Results = results
 	if len(results) == 0 {
 		log.Logger().Infof("the %d ExternalSecrets on second pass are %s", len(o.ExternalSecrets), termcolor.ColorInfo("populated"))
@@ -159,26 +175,47 @@ func (o *Options) Run() error {
 	return nil
 }
 
-// PopulateLoop populates any external secret stores
+// PopulateLoop populates any external secret stores.
+//
+// The properties of all the ExternalSecrets which use the same key in a secret store are merged and written once
+// as back ends like vault replace all the properties of a key on each write
 func (o *Options) PopulateLoop(results []*secretfacade.SecretPair, waited map[string]bool) error {
+	dests := &destinations{}
+
+	// lets merge the current values of the ExternalSecrets sharing a key first so that we don't generate
+	// new values for properties which another ExternalSecret already has a value for
+	for _, r := range results {
+		if isLocalReplica(r) || r.Secret == nil || r.Secret.Data == nil {
+			continue
+		}
+		backendType := r.ExternalSecret.Spec.BackendType
+		location := GetExternalSecretLocation(&r.ExternalSecret)
+		for i := range r.ExternalSecret.Spec.Data {
+			d := &r.ExternalSecret.Spec.Data[i]
+			currentValue := string(r.Secret.Data[d.Name])
+			if currentValue == "" {
+				continue
+			}
+			key := GetSecretKey(v1alpha1.BackendType(backendType), r.ExternalSecret.Name, d.Key)
+			err := dests.get(backendType, location, key).setValue(r, d.Property, d.Name, currentValue, audit.SourceCurrent, false)
+			if err != nil {
+				return errors.Wrapf(err, "failed to merge the current values of ExternalSecret %s", r.Key())
+			}
+		}
+	}
+
 	for _, r := range results {
 		name := r.ExternalSecret.Name
 		backendType := r.ExternalSecret.Spec.BackendType
+		if isLocalReplica(r) {
+			continue
+		}
 
 		// Check if the secret backend is external vault
 		isExternalVault := os.Getenv("EXTERNAL_VAULT")
 		localReplica := false
-		if backendType == "local" {
-			ann := r.ExternalSecret.Annotations
-			if ann != nil {
-				// ignore local replicas
-				if ann[extsecrets.ReplicaAnnotation] == "true" {
-					continue
-				}
-				if ann[extsecrets.ReplicateToAnnotation] != "" {
-					localReplica = true
-				}
-			}
+		if backendType == "local" && r.ExternalSecret.Annotations != nil && r.ExternalSecret.Annotations[extsecrets.ReplicateToAnnotation] != "" {
+			localReplica = true
 		}
 
 		// lets wait until the backend is available
@@ -195,76 +232,83 @@ func (o *Options) PopulateLoop(results []*secretfacade.SecretPair, waited map[st
 			return errors.Wrapf(err, "failed to create a secret manager for ExternalSecret %s", name)
 		}
 
+		if backendType == string(v1alpha1.BackendTypeGSM) && r.ExternalSecret.Spec.ProjectID == "" {
+			log.Logger().Warnf("no GCP project ID found for external secret %s, defaulting to current project", name)
+		}
+
+		location := GetExternalSecretLocation(&r.ExternalSecret)
 		data := r.ExternalSecret.Spec.Data
-		m := map[string]*editor.KeyProperties{}
-		newValueMap := map[string]bool{}
 		for i := range data {
 			d := &data[i]
-			key := GetSecretKey(v1alpha1.BackendType(backendType), r.ExternalSecret.Name, d.Key)
+			key := GetSecretKey(v1alpha1.BackendType(backendType), name, d.Key)
 			property := d.Property
-			entryName := d.Name
-			keyProperties := m[key]
-			if keyProperties == nil {
-				keyProperties = &editor.KeyProperties{
-					Key: key,
-				}
-				if r.ExternalSecret.Spec.BackendType == string(v1alpha1.BackendTypeGSM) {
-					if r.ExternalSecret.Spec.ProjectID != "" {
-						keyProperties.GCPProject = r.ExternalSecret.Spec.ProjectID
-					} else {
-						log.Logger().Warnf("no GCP project ID found for external secret %s, defaulting to current project", r.ExternalSecret.Name)
-					}
-				}
-
-				m[key] = keyProperties
+			dest := dests.get(backendType, location, key)
+			dest.secretManager = secretManager
+			if dest.source == nil {
+				dest.source = r
 			}
 
+			// lets default to the value of another ExternalSecret sharing the key
 			currentValue := ""
 			if r.Secret != nil && r.Secret.Data != nil {
 				currentValue = string(r.Secret.Data[d.Name])
 			}
-			var value string
-			value, err = o.generateSecretValue(r, name, d.Name, currentValue)
+			if currentValue == "" {
+				currentValue = dest.value(property, d.Name)
+			}
+			required, err := o.IsRequired(r, d.Name)
 			if err != nil {
-				return errors.Wrapf(err, "failed to ask user secret value property %s for key %s on ExternalSecret %s", property, key, name)
+				return errors.Wrapf(err, "failed to evaluate if property %s for key %s on ExternalSecret %s is required", property, key, name)
 			}
-
-			// lets always update values for local replicas so that replication triggers to other namespaces
-			if value != "" && (value != currentValue || localReplica) {
-				newValueMap[key] = true
+			var value string
+			source := audit.SourceCurrent
+			if required {
+				value, source, err = o.generateSecretValue(r, name, d.Name, currentValue)
+				if err != nil {
+					return errors.Wrapf(err, "failed to ask user secret value property %s for key %s on ExternalSecret %s", property, key, name)
+				}
 			}
-			if value == "" {
+
+			newValue := value != "" && value != currentValue
+			if !newValue {
 				value = currentValue
+				source = audit.SourceCurrent
+			}
+			err = dest.setValue(r, property, d.Name, value, source, newValue)
+			if err != nil {
+				return errors.Wrapf(err, "conflicting values for key %s", key)
 			}
 
-			// lets always modify all entries if there is a new value
-			// as back ends like vault can't handle only writing 1 value
-			keyProperties.Properties = append(keyProperties.Properties, editor.PropertyValue{
-				Property: property,
-				Value:    value,
-				Name:     entryName,
-			})
+			// lets always update values for local replicas so that replication triggers to other namespaces
+			if newValue || (localReplica && value != "") {
+				dest.changed = true
+			}
 		}
-		for key, keyProperties := range m {
-			// ToDo: Refactor/Simplify with tests
-			if newValueMap[key] && len(keyProperties.Properties) > 0 { //nolint:gocritic
-				annotations := r.ExternalSecret.Spec.Template.Metadata.Annotations
-
-				// handle replicate to annotation for local secrets so that we also copy the secret to other namespaces
-				replicateTo := ""
-				if r.ExternalSecret.Annotations != nil {
-					replicateTo = r.ExternalSecret.Annotations[extsecrets.ReplicateToAnnotation]
-				}
-				if replicateTo != "" {
-					annotations[extsecrets.ReplicateToAnnotation] = replicateTo
-				}
+	}
 
-				labels := r.ExternalSecret.Spec.Template.Metadata.Labels
-				secretType := corev1.SecretType(r.ExternalSecret.Spec.Template.Type)
-				sv := CreateSecretValue(v1alpha1.BackendType(r.ExternalSecret.Spec.BackendType), keyProperties.Properties, annotations, labels, secretType)
-				err = secretManager.SetSecret(GetExternalSecretLocation(&r.ExternalSecret), GetSecretKey(v1alpha1.BackendType(r.ExternalSecret.Spec.BackendType), r.ExternalSecret.Name, key), &sv)
+	// lets always write all the properties of a key if there is a new value merged with
+	// the current properties in the store as back ends like vault can't handle only writing 1 value
+	for _, dest := range dests.items {
+		if !dest.changed || dest.secretManager == nil || len(dest.properties) == 0 {
+			continue
+		}
+		mw := &editor.MergeWrite{
+			Store:             dest.secretManager,
+			Location:          dest.location,
+			Key:               dest.key,
+			Properties:        dest.propertyNames(),
+			Changed:           dest.propertyValues(),
+			CreateSecretValue: dest.secretValue,
+		}
+		err := mw.Write()
+		if err != nil {
+			return errors.Wrapf(err, "failed to save properties of key %s on ExternalSecret %s", dest.key, dest.source.Key())
+		}
+		if o.auditor != nil {
+			for _, e := range dest.auditEvents(o.auditor) {
+				err = o.auditor.Record(e)
 				if err != nil {
-					return errors.Wrapf(err, "failed to save properties %s on ExternalSecret %s", keyProperties.String(), name)
+					log.Logger().Warnf("%s", err.Error())
 				}
 			}
 		}
@@ -272,6 +316,26 @@ func (o *Options) PopulateLoop(results []*secretfacade.SecretPair, waited map[st
 	return nil
 }
 
+// isLocalReplica returns true if the secret is a replica of a local secret which is populated by its source secret
+func isLocalReplica(r *secretfacade.SecretPair) bool {
+	ann := r.ExternalSecret.Annotations
+	return r.ExternalSecret.Spec.BackendType == "local" && ann != nil && ann[extsecrets.ReplicaAnnotation] == "true"
+}
+
+// matching returns the secrets which match the filters
+func (o *Options) matching(results []*secretfacade.SecretPair) []*secretfacade.SecretPair {
+	if !o.HasFilters() {
+		return results
+	}
+	var answer []*secretfacade.SecretPair
+	for _, r := range results {
+		if o.Matches(r) {
+			answer = append(answer, r)
+		}
+	}
+	return answer
+}
+
 func GetSecretStore(backendType v1alpha1.BackendType) secretstore.Type {
 	switch backendType {
 	case v1alpha1.BackendTypeLocal:
@@ -292,11 +356,7 @@ func CreateSecretValue(backendType v1alpha1.BackendType, values []editor.Propert
 	formatValues := func(values []editor.PropertyValue) map[string]string {
 		properties := map[string]string{}
 		for _, p := range values {
-			propertyName := p.Property
-			if propertyName == "" {
-				propertyName = p.Name
-			}
-			properties[propertyName] = p.Value
+			properties[p.PropertyName()] = p.Value
 		}
 		return properties
 	}
@@ -336,47 +396,56 @@ func GetExternalSecretLocation(extsec *v1.ExternalSecret) string {
 	return ""
 }
 
-func (o *Options) generateSecretValue(s *secretfacade.SecretPair, secretName, property, currentValue string) (string, error) {
+func (o *Options) generateSecretValue(s *secretfacade.SecretPair, secretName, property, currentValue string) (string, audit.Source, error) {
 	object, err := s.SchemaObject()
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to find object schema for object %s property %s", secretName, property)
+		return "", "", errors.Wrapf(err, "failed to find object schema for object %s property %s", secretName, property)
 	}
 	if object == nil {
-		return o.helmSecretValue(s, property)
+		return o.helmSecretValueSource(s, property)
 	}
 	propertySchema := object.FindProperty(property)
 	if propertySchema == nil {
-		return o.helmSecretValue(s, property)
+		return o.helmSecretValueSource(s, property)
 	}
 
 	templateText := propertySchema.Template
 	if templateText != "" {
 		// don't regenerate if configured to only do so if non blank
 		if propertySchema.OnlyTemplateIfBlank && currentValue != "" {
-			return "", nil
+			return "", "", nil
 		}
-		return o.EvaluateTemplate(s.ExternalSecret.Namespace, secretName, property, templateText, propertySchema.Retry)
+		value, err := o.EvaluateTemplate(s.ExternalSecret.Namespace, secretName, property, templateText, propertySchema.Retry)
+		if err != nil || value == "" || propertySchema.Format == "" {
+			return value, audit.SourceTemplate, err
+		}
+		// lets make sure the template generated a valid value before it is written to the secret store
+		err = formats.Validate(propertySchema.Format, value)
+		if err != nil {
+			return "", "", errors.Errorf("the template for property %s in object %s generated a value which %s for format %s", property, secretName, err.Error(), propertySchema.Format)
+		}
+		return value, audit.SourceTemplate, nil
 	}
 
 	// for now don't regenerate if we have a current value
 	// longer term we could maybe use metadata to decide how frequently to run generators or regenerate if the value is too old etc
 	if currentValue != "" {
-		return "", nil
+		return "", "", nil
 	}
 
 	generatorName := propertySchema.Generator
 	if generatorName == "" {
 		if propertySchema.DefaultValue != "" {
-			return propertySchema.DefaultValue, nil
+			return propertySchema.DefaultValue, audit.SourceDefault, nil
 		}
 
 		// lets try fetch the default value from the generated helm secrets
-		return o.helmSecretValue(s, property)
+		return o.helmSecretValueSource(s, property)
 	}
 
 	generator := o.Generators[generatorName]
 	if generator == nil {
-		return "", errors.Errorf("could not find generator %s for property %s in object %s", generatorName, property, secretName)
+		return "", "", errors.Errorf("could not find generator %s for property %s in object %s", generatorName, property, secretName)
 	}
 
 	args := &generators.Arguments{
@@ -385,9 +454,15 @@ func (o *Options) generateSecretValue(s *secretfacade.SecretPair, secretName, pr
 	}
 	value, err := generator(args)
 	if err != nil {
-		return value, errors.Wrapf(err, "failed to invoke generator %s for property %s in object %s", generatorName, property, secretName)
+		return value, audit.SourceGenerator, errors.Wrapf(err, "failed to invoke generator %s for property %s in object %s", generatorName, property, secretName)
 	}
-	return value, nil
+	return value, audit.SourceGenerator, nil
+}
+
+// helmSecretValueSource returns the default value from the helm secrets and its source
+func (o *Options) helmSecretValueSource(s *secretfacade.SecretPair, property string) (string, audit.Source, error) {
+	value, err := o.helmSecretValue(s, property)
+	return value, audit.SourceHelm, err
 }
 
 func (o *Options) waitForBackend(backendType, isExternalVault string) error {
@@ -439,12 +514,18 @@ func (o *Options) loadGenerators() {
 }
 
 func (o *Options) getSecretManager(backendType, isExternalVault string) (secretstore.Interface, error) {
+	return NewSecretManager(o.SecretStoreManagerFactory, o.KubeClient, backendType, isExternalVault)
+}
+
+// NewSecretManager creates a secret manager for the given ExternalSecret backend type setting up the vault
+// environment variables if using an internal vault
+func NewSecretManager(secretStoreManagerFactory secretstore.FactoryInterface, kubeClient kubernetes.Interface, backendType, isExternalVault string) (secretstore.Interface, error) {
 	store := GetSecretStore(v1alpha1.BackendType(backendType))
 	if isExternalVault == "true" {
 		log.Logger().Debug("connecting to external vault")
 	}
 	if store == secretstore.SecretStoreTypeVault && isExternalVault != "true" {
-		envMap, err := vaultcli.CreateVaultEnv(o.KubeClient)
+		envMap, err := vaultcli.CreateVaultEnv(kubeClient)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error creating vault env vars")
 		}
@@ -455,10 +536,41 @@ func (o *Options) getSecretManager(backendType, isExternalVault string) (secrets
 			}
 		}
 	}
-	secretManager, err := o.SecretStoreManagerFactory.NewSecretManager(store)
+	secretManager, err := secretStoreManagerFactory.NewSecretManager(store)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error creating secret manager")
 	}
+
+	// lets use check-and-set when merging properties with the real vault secret store
+	if _, ok := secretStoreManagerFactory.(*factory.SecretManagerFactory); ok && store == secretstore.SecretStoreTypeVault {
+		client, err := vaultstore.NewClient(kubeClient, isExternalVault)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating vault client")
+		}
+		secretManager = vaultstore.NewVersionedStore(secretManager, client)
+	}
+	return secretManager, nil
+}
+
+// SecretManagers lazily creates and caches the secret manager of each backend type
+type SecretManagers struct {
+	managers map[string]secretstore.Interface
+}
+
+// Get returns the secret manager for the backend type creating it if required
+func (s *SecretManagers) Get(secretStoreManagerFactory secretstore.FactoryInterface, kubeClient kubernetes.Interface, backendType string) (secretstore.Interface, error) {
+	if s.managers == nil {
+		s.managers = map[string]secretstore.Interface{}
+	}
+	secretManager := s.managers[backendType]
+	if secretManager != nil {
+		return secretManager, nil
+	}
+	secretManager, err := NewSecretManager(secretStoreManagerFactory, kubeClient, backendType, os.Getenv("EXTERNAL_VAULT"))
+	if err != nil {
+		return nil, err
+	}
+	s.managers[backendType] = secretManager
 	return secretManager, nil
 }
 
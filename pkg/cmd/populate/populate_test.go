@@ -1,6 +1,8 @@
 package populate_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/maps"
 
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate/templatertesting"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
@@ -381,3 +384,103 @@ func TestParseRequirements(t *testing.T) {
 	value := maps.GetMapValueAsStringViaPath(requirementsMap, "cluster.registry")
 	assert.Equal(t, expectedRegistry, value, "cluster.registry on the requirementsMap")
 }
+
+func TestPopulateSharedKey(t *testing.T) {
+	vaultLocation := "https://127.0.0.1:8200"
+
+	buf := &bytes.Buffer{}
+	_, fakeStore, err := runPopulateDir(t, "test_data/populate_shared", &audit.WriterSink{Out: buf})
+	require.NoError(t, err, "failed to invoke Run()")
+
+	// both ExternalSecrets write to the same vault key so the properties must be merged
+	fakeStore.AssertValueEquals(t, vaultLocation, "secret/data/jx/registry", "username", "admin")
+	fakeStore.AssertValueEquals(t, vaultLocation, "secret/data/jx/registry", "password", "s3cret")
+
+	// the single write is audited against each ExternalSecret which provided a value
+	var events []*audit.Event
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		e := &audit.Event{}
+		err = decoder.Decode(e)
+		require.NoError(t, err, "failed to parse audit event")
+		events = append(events, e)
+	}
+	// the fake Secrets are not populated by an operator so the second pass writes again
+	require.NotEmpty(t, events, "audit events")
+	names := map[string]bool{}
+	for _, e := range events {
+		names[e.ExternalSecret] = true
+		assert.Equal(t, "jx-secret populate", e.Command, "command")
+		assert.Equal(t, "secret/data/jx/registry", e.Key, "key")
+		require.Len(t, e.Properties, 1, "properties for %s", e.ExternalSecret)
+		assert.Equal(t, audit.SourceDefault, e.Properties[0].Source, "source for %s", e.ExternalSecret)
+		assert.NotContains(t, e.Properties[0].Hash, "admin", "hash for %s", e.ExternalSecret)
+	}
+	assert.Equal(t, map[string]bool{"registry-user": true, "registry-password": true}, names, "audited ExternalSecrets")
+}
+
+func TestPopulateSharedKeyConflict(t *testing.T) {
+	_, _, err := runPopulateDir(t, "test_data/populate_conflict")
+	require.Error(t, err, "should fail when two ExternalSecrets have different values for the same property")
+	assert.Contains(t, err.Error(), "jx/registry-admin", "error message")
+	assert.Contains(t, err.Error(), "jx/registry-user", "error message")
+	assert.Contains(t, err.Error(), "property username of key secret/data/jx/registry", "error message")
+}
+
+func TestPopulateSharedKeyWithoutProperties(t *testing.T) {
+	vaultLocation := "https://127.0.0.1:8200"
+
+	_, fakeStore, err := runPopulateDir(t, "test_data/populate_shared_names")
+	require.NoError(t, err, "failed to invoke Run()")
+
+	// entries without a property use their name as the property so must not be merged together
+	fakeStore.AssertValueEquals(t, vaultLocation, "secret/data/jx/my-config", "foo", "v1")
+	fakeStore.AssertValueEquals(t, vaultLocation, "secret/data/jx/my-config", "bar", "v2")
+}
+
+func TestPopulateKeepsStoreValuesOfOptionalProperties(t *testing.T) {
+	vaultLocation := "https://127.0.0.1:8200"
+	key := "secret/data/jx/registry"
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	_, err := fakeFactory.NewSecretManager(secretstore.SecretStoreTypeVault)
+	require.NoError(t, err)
+	fakeStore := fakeFactory.GetSecretStore()
+	err = fakeStore.SetSecret(vaultLocation, key, &secretstore.SecretValue{PropertyValues: map[string]string{"password": "existing"}})
+	require.NoError(t, err)
+
+	// the password is not required and has no value in the unsynchronised Secret so must not replace the stored value
+	_, _, err = runPopulateDirWithFactory(t, "test_data/populate_optional", fakeFactory)
+	require.NoError(t, err, "failed to invoke Run()")
+
+	fakeStore.AssertValueEquals(t, vaultLocation, key, "username", "admin")
+	fakeStore.AssertValueEquals(t, vaultLocation, key, "password", "existing")
+}
+
+func runPopulateDir(t *testing.T, dir string, sinks ...audit.Sink) (*populate.Options, *secretstorefake.SecretStore, error) {
+	return runPopulateDirWithFactory(t, dir, &secretstorefake.SecretManagerFactory{}, sinks...)
+}
+
+func runPopulateDirWithFactory(t *testing.T, dir string, fakeFactory *secretstorefake.SecretManagerFactory, sinks ...audit.Sink) (*populate.Options, *secretstorefake.SecretStore, error) {
+	ns := "jx"
+	_, o := populate.NewCmdPopulate()
+	o.Dir = dir
+	o.NoWait = true
+	o.Namespace = ns
+	o.BootSecretNamespace = ns
+	o.SecretStoreManagerFactory = fakeFactory
+	o.KubeClient = fake.NewSimpleClientset(testsecrets.AddVaultSecrets()...)
+	o.Audit.Sinks = sinks
+	o.Audit.User = "test-user"
+
+	extSecretsDir := filepath.Join(dir, "extsecrets")
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, extSecretsDir)
+	require.NotEmpty(t, dynObjects, "failed to load ExternalSecrets from dir %s", extSecretsDir)
+
+	var err error
+	o.SecretClient, err = extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...))
+	require.NoError(t, err, "failed to create secret client")
+
+	err = o.Run()
+	return o, fakeFactory.GetSecretStore(), err
+}
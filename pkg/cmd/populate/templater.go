@@ -8,10 +8,10 @@ import (
 	"text/template"
 
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
-	"github.com/jenkins-x/jx-helpers/v3/pkg/maps"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
@@ -31,7 +31,6 @@ func (o *Options) EvaluateTemplate(namespace, secretName, property, templateText
 	}
 
 	if o.Requirements == nil {
-		var requirementsResource *jxcore.Requirements
 		requirementsResource, _, err := jxcore.LoadRequirementsConfig(o.Dir, false)
 		if err != nil {
 			return "", errors.Wrapf(err, "failed to load jx-requirements.yml in dir %s", o.Dir)
@@ -236,20 +235,7 @@ func (o *Options) EvaluateTemplate(namespace, secretName, property, templateText
 
 // CreateRequirementsMap creates the requirements map thats used to send into
 func CreateRequirementsMap(req *jxcore.RequirementsConfig) (map[string]interface{}, error) {
-	requirementsMap, err := req.ToMap()
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed turn requirements into a map: %v", req)
-	}
-	if requirementsMap["storage"] == nil {
-		requirementsMap["storage"] = map[string]string{}
-	}
-	if requirementsMap["cluster"] == nil {
-		requirementsMap["cluster"] = map[string]string{}
-	}
-	if maps.GetMapValueAsStringViaPath(requirementsMap, "cluster.registry") == "" {
-		maps.SetMapValueViaPath(requirementsMap, "cluster.registry", "")
-	}
-	return requirementsMap, nil
+	return secretfacade.CreateRequirementsMap(req)
 }
 
 func (o *Options) getExternalSecretValue(lookupSecretName, lookupKey, namespace string, retryTemplate bool) string {
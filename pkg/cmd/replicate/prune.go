@@ -0,0 +1,147 @@
+package replicate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kyamls"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// replicaFile a replica ExternalSecret found in the namespaces dir
+type replicaFile struct {
+	Name      string
+	Namespace string
+	Path      string
+	// Source the namespace and name of the source ExternalSecret if known
+	Source string
+}
+
+// replicaSource a source ExternalSecret and the namespaces it is replicated to
+type replicaSource struct {
+	// annotated the source has a replicate-to annotation which is blank if it is not replicated to any namespace
+	annotated   bool
+	replicateTo []string
+}
+
+// findReplicas finds the replica ExternalSecrets in the namespaces dir
+func (o *Options) findReplicas() ([]*replicaFile, error) {
+	var answer []*replicaFile
+	modifyFn := func(node *yaml.RNode, path string) (bool, error) {
+		annotations := node.GetAnnotations()
+		if annotations[extsecrets.ReplicaAnnotation] != "true" {
+			return false, nil
+		}
+		ns := kyamls.GetNamespace(node, path)
+		if ns == "" {
+			ns = o.namespaceFromPath(path)
+		}
+		answer = append(answer, &replicaFile{
+			Name:      kyamls.GetName(node, path),
+			Namespace: ns,
+			Path:      path,
+			Source:    annotations[extsecrets.ReplicaSourceAnnotation],
+		})
+		return false, nil
+	}
+
+	err := kyamls.ModifyFiles(o.NamespacesDir, modifyFn, kyamls.Filter{
+		Kinds: []string{"ExternalSecret"},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find replica ExternalSecrets in dir %s", o.NamespacesDir)
+	}
+	return answer, nil
+}
+
+// PruneReplicas removes the replica ExternalSecrets in the namespaces dir which were replicated from the --from namespace
+// and whose source ExternalSecret no longer exists or is no longer replicated to the namespace of the replica
+func (o *Options) PruneReplicas() error {
+	replicas, err := o.findReplicas()
+	if err != nil {
+		return err
+	}
+
+	// the source ExternalSecrets in the from namespace indexed by namespace and name
+	sources := map[string]*replicaSource{}
+	modifyFn := func(node *yaml.RNode, path string) (bool, error) {
+		annotations := node.GetAnnotations()
+		if annotations[extsecrets.ReplicaAnnotation] == "true" {
+			return false, nil
+		}
+		ns := kyamls.GetNamespace(node, path)
+		if ns == "" {
+			ns = o.namespaceFromPath(path)
+		}
+		if ns != o.From {
+			return false, nil
+		}
+		value, annotated := annotations[extsecrets.ReplicateToAnnotation]
+		source := &replicaSource{annotated: annotated}
+		for _, to := range strings.Split(value, ",") {
+			if to != "" {
+				source.replicateTo = append(source.replicateTo, to)
+			}
+		}
+		sources[ns+"/"+kyamls.GetName(node, path)] = source
+		return false, nil
+	}
+
+	err = kyamls.ModifyFiles(o.NamespacesDir, modifyFn, kyamls.Filter{
+		Kinds: []string{"ExternalSecret"},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to find ExternalSecrets in dir %s", o.NamespacesDir)
+	}
+
+	o.Pruned = nil
+	for _, r := range replicas {
+		if r.Source == "" {
+			log.Logger().Warnf("not pruning replica %s/%s as it has no %s annotation. Run replicate again to add it", r.Namespace, r.Name, extsecrets.ReplicaSourceAnnotation)
+			continue
+		}
+		// lets never prune replicas of ExternalSecrets in other namespaces as we have not looked for their sources
+		if !strings.HasPrefix(r.Source, o.From+"/") {
+			continue
+		}
+		source := sources[r.Source]
+		reason := ""
+		switch {
+		case source == nil:
+			reason = "the source ExternalSecret " + r.Source + " no longer exists"
+		case !source.annotated:
+			log.Logger().Warnf("not pruning replica %s/%s as the source ExternalSecret has no %s annotation. Run replicate again to add it", r.Namespace, r.Name, extsecrets.ReplicateToAnnotation)
+			continue
+		case stringhelpers.StringArrayIndex(source.replicateTo, r.Namespace) < 0:
+			reason = "the source ExternalSecret is no longer replicated to namespace " + r.Namespace
+		default:
+			continue
+		}
+
+		err = os.Remove(r.Path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove file %s", r.Path)
+		}
+		o.Pruned = append(o.Pruned, r.Path)
+		log.Logger().Infof("removed replica ExternalSecret %s in namespace %s as %s", info(r.Name), info(r.Namespace), reason)
+	}
+
+	if len(o.Pruned) == 0 {
+		log.Logger().Infof("no replica ExternalSecrets to prune")
+	}
+	return nil
+}
+
+// namespaceFromPath returns the namespace of a file in the namespaces dir
+func (o *Options) namespaceFromPath(path string) string {
+	rel, err := filepath.Rel(o.NamespacesDir, path)
+	if err != nil {
+		return ""
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")[0]
+}
@@ -16,15 +16,18 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kyamls"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
-	"github.com/jenkins-x/jx-helpers/v3/pkg/yamls"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
 var (
+	info = termcolor.ColorInfo
+
 	labelLong = templates.LongDesc(`
 		Replicates the given ExternalSecret resources into other Environments or Namespaces
 `)
@@ -35,6 +38,15 @@ var (
 
 		# replicates the ExternalSecret resources to the local Environments
 		%s replicate --name=mysecretname --to jx-staging,jx-production
+
+		# replicates the ExternalSecret resources to all the Namespaces matching a glob
+		%s replicate --name=mysecretname --to 'jx-preview-*'
+
+		# replicates the ExternalSecret resources to the Environments or Namespaces with a label
+		%s replicate --name=mysecretname --to-selector env=staging
+
+		# removes any replica ExternalSecret resources which are no longer required
+		%s replicate --prune
 	`)
 )
 
@@ -47,8 +59,20 @@ type Options struct {
 	NamespacesDir string
 	From          string
 	Selector      string
+	ToSelector    string
 	Name          []string
 	To            []string
+	Prune         bool
+
+	// Pruned the files of the replicas which were removed when pruning
+	Pruned []string
+}
+
+// targetNamespace a namespace discovered from an Environment or Namespace resource
+type targetNamespace struct {
+	Name      string
+	Labels    map[string]string
+	Permanent bool
 }
 
 // NewCmdReplicate creates a command object for the command
@@ -59,7 +83,7 @@ func NewCmdReplicate() (*cobra.Command, *Options) {
 		Use:     "replicate",
 		Short:   "Replicates the given ExternalSecret resources into other Environments or Namespaces",
 		Long:    labelLong,
-		Example: fmt.Sprintf(labelExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Example: fmt.Sprintf(labelExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := o.Run()
 			helper.CheckErr(err)
@@ -71,7 +95,9 @@ func NewCmdReplicate() (*cobra.Command, *Options) {
 	cmd.Flags().StringVarP(&o.Selector, "selector", "s", "", "defines the label selector to find the ExternalSecret resources to replicate")
 	cmd.Flags().StringArrayVarP(&o.Name, "name", "n", nil, "specifies the names of the ExternalSecrets to replicate if not using a selector")
 	cmd.Flags().StringVarP(&o.From, "from", "", "", "one or more Namespaces to replicate the ExternalSecret from")
-	cmd.Flags().StringArrayVarP(&o.To, "to", "t", nil, "one or more Namespaces to replicate the ExternalSecret to")
+	cmd.Flags().StringArrayVarP(&o.To, "to", "t", nil, "one or more Namespaces or Namespace globs (e.g. jx-preview-*) to replicate the ExternalSecret to")
+	cmd.Flags().StringVarP(&o.ToSelector, "to-selector", "", "", "the label selector of the Environment or Namespace resources in the output directory to replicate the ExternalSecret to")
+	cmd.Flags().BoolVarP(&o.Prune, "prune", "", false, "removes any replica ExternalSecrets replicated from the --from namespace whose source no longer exists or is no longer replicated to the replica namespace")
 	cmd.Flags().StringVarP(&o.OutputDir, "output-dir", "o", "", "the output directory which defaults to 'config-root' in the directory")
 	return cmd, o
 }
@@ -86,7 +112,7 @@ func (o *Options) Run() error {
 	if path == "" {
 		return options.MissingOption("file")
 	}
-	if len(o.Name) == 0 && o.Selector == "" {
+	if len(o.Name) == 0 && o.Selector == "" && !o.Prune {
 		return options.MissingOption("name")
 	}
 	if o.From == "" {
@@ -102,20 +128,47 @@ func (o *Options) Run() error {
 	if o.NamespacesDir == "" {
 		o.NamespacesDir = filepath.Join(o.OutputDir, "namespaces")
 	}
-	dir := filepath.Join(o.NamespacesDir, o.From)
 
-	if len(o.To) == 0 {
-		err = o.discoverEnvironmentNamespaces(dir)
+	if len(o.Name) > 0 || o.Selector != "" {
+		err = o.replicate()
 		if err != nil {
-			return errors.Wrapf(err, "failed to discover the Environment namespaces in dir %s", dir)
+			return err
 		}
+	}
+	if o.Prune {
+		return o.PruneReplicas()
+	}
+	return nil
+}
 
-		if len(o.To) == 0 {
-			log.Logger().Warnf("no --to specified and no remote Environments found")
-			return nil
+func (o *Options) replicate() error {
+	dir := filepath.Join(o.NamespacesDir, o.From)
+
+	var err error
+	requested := strings.Join(o.To, ",")
+	o.To, err = o.resolveTargetNamespaces()
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the namespaces to replicate to in dir %s", o.OutputDir)
+	}
+	if len(o.To) == 0 {
+		// lets still remove any existing replicas as the ExternalSecrets are no longer replicated anywhere
+		switch {
+		case requested != "" && o.ToSelector != "":
+			log.Logger().Warnf("no namespaces match --to %s or --to-selector %s so removing any existing replicas", requested, o.ToSelector)
+		case requested != "":
+			log.Logger().Warnf("no namespaces match --to %s so removing any existing replicas", requested)
+		case o.ToSelector != "":
+			log.Logger().Warnf("no namespaces match --to-selector %s so removing any existing replicas", o.ToSelector)
+		default:
+			log.Logger().Warnf("no --to specified and no remote Environments found so removing any existing replicas")
 		}
 	}
 
+	replicas, err := o.findReplicas()
+	if err != nil {
+		return err
+	}
+
 	found := map[string]bool{}
 
 	filter := kyamls.Filter{
@@ -133,12 +186,24 @@ func (o *Options) Run() error {
 		name := kyamls.GetName(node, path)
 		found[name] = true
 
-		for _, ns := range o.To {
-			relPath, err := filepath.Rel(dir, path)
-			if err != nil {
-				return false, errors.Wrapf(err, "failed to get relative path of %s from %s", path, dir)
-			}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get relative path of %s from %s", path, dir)
+		}
+		previous := strings.Split(node.GetAnnotations()[extsecrets.ReplicateToAnnotation], ",")
 
+		// the replicas should not replicate themselves
+		err = node.PipeE(yaml.ClearAnnotation(extsecrets.ReplicateToAnnotation))
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to remove replicate annotation for path %s", path)
+		}
+		source := o.From + "/" + name
+		err = node.PipeE(yaml.SetAnnotation(extsecrets.ReplicaSourceAnnotation, source))
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to add replica source annotation for path %s", path)
+		}
+
+		for _, ns := range o.To {
 			err = node.PipeE(yaml.LookupCreate(yaml.ScalarNode, "metadata", "namespace"), yaml.FieldSetter{StringValue: ns})
 			if err != nil {
 				return false, errors.Wrapf(err, "failed to set metadata.namespace to %s", ns)
@@ -162,9 +227,28 @@ func (o *Options) Run() error {
 			}
 			log.Logger().Debugf("replicated ExternalSecret %s/%s to %s", ns, name, outFile)
 		}
-		err = o.addReplicatedLocalBackendAnnotation(path)
+
+		// lets remove the replicas in namespaces which are no longer replicated to
+		for _, r := range replicas {
+			if r.Source == source && stringhelpers.StringArrayIndex(o.To, r.Namespace) < 0 {
+				err = o.removeReplica(r.Path)
+				if err != nil {
+					return false, errors.Wrapf(err, "failed to remove replica of ExternalSecret %s from namespace %s", name, r.Namespace)
+				}
+			}
+		}
+		for _, ns := range previous {
+			if ns == "" || stringhelpers.StringArrayIndex(o.To, ns) >= 0 {
+				continue
+			}
+			err = o.removeReplica(filepath.Join(o.NamespacesDir, ns, relPath))
+			if err != nil {
+				return false, errors.Wrapf(err, "failed to remove replica of ExternalSecret %s from namespace %s", name, ns)
+			}
+		}
+		err = o.addReplicateToAnnotation(path)
 		if err != nil {
-			return false, errors.Wrapf(err, "failed to annotate replicated local backend")
+			return false, errors.Wrapf(err, "failed to annotate replicated ExternalSecret")
 		}
 		return false, nil
 	}
@@ -182,66 +266,140 @@ func (o *Options) Run() error {
 	return nil
 }
 
-func (o *Options) addReplicatedLocalBackendAnnotation(path string) error {
+// addReplicateToAnnotation records the namespaces a source ExternalSecret is replicated to so that replicas
+// can be pruned and, for local backend secrets, the Secret is also copied to those namespaces
+func (o *Options) addReplicateToAnnotation(path string) error {
 	node, err := yaml.ReadFile(path)
 	if err != nil {
 		return errors.Wrapf(err, "failed to load %s", path)
 	}
-
-	backend, err := node.Pipe(yaml.Lookup("spec", "backendType"))
+	err = node.PipeE(yaml.SetAnnotation(extsecrets.ReplicateToAnnotation, strings.Join(o.To, ",")))
 	if err != nil {
-		return errors.Wrapf(err, "failed to find backendType for %s", path)
+		return errors.Wrapf(err, "failed to add replicate annotation for path %s", path)
 	}
-	if backend == nil {
-		return nil
+	err = yaml.WriteFile(node, path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", path)
 	}
+	return nil
+}
 
-	backendType, err := backend.String()
+// removeReplica removes the given file if it is a replica ExternalSecret
+func (o *Options) removeReplica(path string) error {
+	exists, err := files.FileExists(path)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get backendType for %s", path)
+		return errors.Wrapf(err, "failed to check if file exists %s", path)
 	}
-	backendType = strings.TrimSpace(backendType)
-	if backendType != "local" {
-		log.Logger().Debugf("ignoring backend type %s", backendType)
+	if !exists {
 		return nil
 	}
-
-	// lets add an annotation
-	err = node.PipeE(yaml.SetAnnotation(extsecrets.ReplicateToAnnotation, strings.Join(o.To, ",")))
+	node, err := yaml.ReadFile(path)
 	if err != nil {
-		return errors.Wrapf(err, "failed to add replicate annotation for path %s", path)
+		return errors.Wrapf(err, "failed to load %s", path)
 	}
-	err = yaml.WriteFile(node, path)
+	if node.GetAnnotations()[extsecrets.ReplicaAnnotation] != "true" {
+		log.Logger().Warnf("not removing %s as it is not a replica", path)
+		return nil
+	}
+	err = os.Remove(path)
 	if err != nil {
-		return errors.Wrapf(err, "failed to save file %s", path)
+		return errors.Wrapf(err, "failed to remove file %s", path)
 	}
+	log.Logger().Infof("removed replica %s", info(path))
 	return nil
 }
 
-func (o *Options) discoverEnvironmentNamespaces(dir string) error {
-	// lets try find the environment namespaces by default
-	modifyFn := func(node *yaml.RNode, path string) (bool, error) {
-		env := &jenkinsv1.Environment{}
-		err := yamls.LoadFile(path, env)
+// resolveTargetNamespaces returns the namespaces to replicate to from the explicit namespaces, globs and selector.
+//
+// If none are specified the permanent Environment namespaces are used
+func (o *Options) resolveTargetNamespaces() ([]string, error) {
+	var answer []string
+	add := func(ns string) {
+		if ns != "" && ns != o.From && stringhelpers.StringArrayIndex(answer, ns) < 0 {
+			answer = append(answer, ns)
+		}
+	}
+
+	var globs []string
+	for _, ns := range o.To {
+		for _, name := range strings.Split(ns, ",") {
+			name = strings.TrimSpace(name)
+			if strings.ContainsAny(name, "*?[") {
+				globs = append(globs, name)
+			} else {
+				add(name)
+			}
+		}
+	}
+	if len(globs) == 0 && o.ToSelector == "" && len(answer) > 0 {
+		return answer, nil
+	}
+
+	discovered, err := o.discoverNamespaces()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to discover namespaces")
+	}
+
+	if len(globs) == 0 && o.ToSelector == "" {
+		for _, t := range discovered {
+			if t.Permanent {
+				add(t.Name)
+			}
+		}
+		return answer, nil
+	}
+
+	var selector labels.Selector
+	if o.ToSelector != "" {
+		selector, err = labels.Parse(o.ToSelector)
 		if err != nil {
-			return false, errors.Wrapf(err, "failed to parse Environment: %s", path)
+			return nil, errors.Wrapf(err, "failed to parse selector %s", o.ToSelector)
 		}
-		if env.Spec.Kind != jenkinsv1.EnvironmentKindTypePermanent {
-			return false, nil
+	}
+	for _, t := range discovered {
+		if selector != nil && selector.Matches(labels.Set(t.Labels)) {
+			add(t.Name)
+			continue
 		}
+		for _, glob := range globs {
+			matched, err := filepath.Match(glob, t.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse namespace glob %s", glob)
+			}
+			if matched {
+				add(t.Name)
+				break
+			}
+		}
+	}
+	return answer, nil
+}
 
-		ens := env.Spec.Namespace
-		if ens != "" && stringhelpers.StringArrayIndex(o.To, ens) < 0 {
-			o.To = append(o.To, ens)
+// discoverNamespaces finds the namespaces of the Environment and Namespace resources in the output directory
+func (o *Options) discoverNamespaces() ([]*targetNamespace, error) {
+	var answer []*targetNamespace
+	modifyFn := func(node *yaml.RNode, path string) (bool, error) {
+		t := &targetNamespace{
+			Labels: node.GetLabels(),
+		}
+		switch kyamls.GetKind(node, path) {
+		case "Environment":
+			t.Name = kyamls.GetStringField(node, path, "spec", "namespace")
+			t.Permanent = kyamls.GetStringField(node, path, "spec", "kind") == string(jenkinsv1.EnvironmentKindTypePermanent)
+		default:
+			t.Name = kyamls.GetName(node, path)
+		}
+		if t.Name != "" {
+			answer = append(answer, t)
 		}
 		return false, nil
 	}
 
-	err := kyamls.ModifyFiles(dir, modifyFn, kyamls.Filter{
-		Kinds: []string{"Environment"},
+	err := kyamls.ModifyFiles(o.OutputDir, modifyFn, kyamls.Filter{
+		Kinds: []string{"Environment", "Namespace"},
 	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to find Environment namespaces in dir %s", dir)
+		return nil, errors.Wrapf(err, "failed to find Environment and Namespace resources in dir %s", o.OutputDir)
 	}
-	return nil
+	return answer, nil
 }
@@ -1,6 +1,7 @@
 package replicate_test
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -81,3 +82,201 @@ func AssertReplicate(t *testing.T, callback func(o *replicate.Options)) {
 	testhelpers.AssertAnnotation(t, extsecrets.ReplicateToAnnotation, strings.Join(o.To, ","), es.ObjectMeta, "source tekton should be annotated")
 	t.Logf("added annotation to tekton source file %s of %s: %s", tektonSourceFile, extsecrets.ReplicateToAnnotation, es.Annotations[extsecrets.ReplicateToAnnotation])
 }
+
+func TestReplicateToGlobAndSelectorRemovesOldReplicas(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceData := "test_data"
+	err := files.CopyDirOverwrite(sourceData, tmpDir)
+	require.NoError(t, err, "failed to copy generated crds at %s to %s", sourceData, tmpDir)
+
+	clusterDir := filepath.Join(tmpDir, "config-root", "cluster", "namespaces")
+	require.NoError(t, os.MkdirAll(clusterDir, files.DefaultDirWritePermissions))
+	for _, ns := range []string{"jx-preview-1", "jx-preview-2"} {
+		text := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: " + ns + "\n  labels:\n    preview: \"true\"\n"
+		err = os.WriteFile(filepath.Join(clusterDir, ns+".yaml"), []byte(text), files.DefaultFileWritePermissions)
+		require.NoError(t, err, "failed to write namespace %s", ns)
+	}
+
+	_, o := replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"lighthouse-oauth-token"}
+	o.To = []string{"jx-preview-*"}
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate to namespace glob")
+	require.Equal(t, []string{"jx-preview-1", "jx-preview-2"}, o.To, "should have matched the namespace glob")
+
+	for _, ns := range o.To {
+		assert.FileExists(t, filepath.Join(o.NamespacesDir, ns, "lighthouse", "lighthouse-oauth-token.yaml"), "should have replicated to %s", ns)
+	}
+
+	// now lets replicate to the staging environment only which should remove the preview replicas
+	_, o = replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"lighthouse-oauth-token"}
+	o.ToSelector = "env=staging"
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate to selector")
+	require.Equal(t, []string{"jx-staging"}, o.To, "should have matched the Environment selector")
+
+	assert.FileExists(t, filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-oauth-token.yaml"), "should have replicated to jx-staging")
+	for _, ns := range []string{"jx-preview-1", "jx-preview-2"} {
+		assert.NoFileExists(t, filepath.Join(o.NamespacesDir, ns, "lighthouse", "lighthouse-oauth-token.yaml"), "should have removed the replica from %s", ns)
+	}
+
+	es := &v1.ExternalSecret{}
+	replicaFile := filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-oauth-token.yaml")
+	err = yamls.LoadFile(replicaFile, es)
+	require.NoError(t, err, "failed to load file %s", replicaFile)
+	testhelpers.AssertAnnotation(t, extsecrets.ReplicaSourceAnnotation, "jx/lighthouse-oauth-token", es.ObjectMeta, "replica should reference its source")
+
+	// the replicate-to annotation is recorded for every backend type
+	sourceFile := filepath.Join(o.NamespacesDir, "jx", "lighthouse", "lighthouse-oauth-token.yaml")
+	es = &v1.ExternalSecret{}
+	err = yamls.LoadFile(sourceFile, es)
+	require.NoError(t, err, "failed to load file %s", sourceFile)
+	testhelpers.AssertAnnotation(t, extsecrets.ReplicateToAnnotation, "jx-staging", es.ObjectMeta, "vault source should be annotated")
+
+	// a --to which matches no namespaces still removes the existing replicas
+	_, o = replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"lighthouse-oauth-token"}
+	o.To = []string{"jx-missing-*"}
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate to a glob matching no namespaces")
+	assert.Empty(t, o.To, "should not have matched any namespaces")
+	assert.NoFileExists(t, replicaFile, "should have removed the replica from jx-staging")
+}
+
+func TestReplicatePrune(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceData := "test_data"
+	err := files.CopyDirOverwrite(sourceData, tmpDir)
+	require.NoError(t, err, "failed to copy generated crds at %s to %s", sourceData, tmpDir)
+
+	_, o := replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"knative-docker-user-pass", "lighthouse-oauth-token"}
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate")
+
+	// lets remove a source and hand edit the replication of the other
+	err = os.Remove(filepath.Join(o.NamespacesDir, "jx", "tekton", "knative-docker-user-pass.yaml"))
+	require.NoError(t, err, "failed to remove source")
+
+	sourceFile := filepath.Join(o.NamespacesDir, "jx", "lighthouse", "lighthouse-oauth-token.yaml")
+	es := &v1.ExternalSecret{}
+	err = yamls.LoadFile(sourceFile, es)
+	require.NoError(t, err, "failed to load file %s", sourceFile)
+	es.Annotations[extsecrets.ReplicateToAnnotation] = "jx-production"
+	err = yamls.SaveFile(es, sourceFile)
+	require.NoError(t, err, "failed to save file %s", sourceFile)
+
+	_, o = replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Prune = true
+	err = o.Run()
+	require.NoError(t, err, "failed to prune")
+
+	expected := []string{
+		filepath.Join(o.NamespacesDir, "jx-production", "tekton", "knative-docker-user-pass.yaml"),
+		filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-oauth-token.yaml"),
+		filepath.Join(o.NamespacesDir, "jx-staging", "tekton", "knative-docker-user-pass.yaml"),
+	}
+	assert.ElementsMatch(t, expected, o.Pruned, "pruned files")
+	for _, f := range expected {
+		assert.NoFileExists(t, f, "should have pruned file")
+	}
+	assert.FileExists(t, filepath.Join(o.NamespacesDir, "jx-production", "lighthouse", "lighthouse-oauth-token.yaml"), "should have kept the replica")
+	assert.FileExists(t, sourceFile, "should have kept the source")
+}
+
+func TestReplicatePruneNonLocalSource(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceData := "test_data"
+	err := files.CopyDirOverwrite(sourceData, tmpDir)
+	require.NoError(t, err, "failed to copy generated crds at %s to %s", sourceData, tmpDir)
+
+	// both sources use the vault backend
+	_, o := replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"lighthouse-hmac-token", "lighthouse-oauth-token"}
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate")
+
+	setReplicateTo := func(sourceFile, replicateTo string) {
+		es := &v1.ExternalSecret{}
+		err = yamls.LoadFile(sourceFile, es)
+		require.NoError(t, err, "failed to load file %s", sourceFile)
+		assert.Equal(t, "vault", es.Spec.BackendType, "backend type of %s", sourceFile)
+		testhelpers.AssertAnnotation(t, extsecrets.ReplicateToAnnotation, "jx-staging,jx-production", es.ObjectMeta, "replicate should annotate the source "+sourceFile)
+		es.Annotations[extsecrets.ReplicateToAnnotation] = replicateTo
+		err = yamls.SaveFile(es, sourceFile)
+		require.NoError(t, err, "failed to save file %s", sourceFile)
+	}
+
+	// lets stop replicating one source to production and the other to any namespace
+	setReplicateTo(filepath.Join(o.NamespacesDir, "jx", "lighthouse", "lighthouse-oauth-token.yaml"), "jx-staging")
+	setReplicateTo(filepath.Join(o.NamespacesDir, "jx", "lighthouse", "lighthouse-hmac-token.yaml"), "")
+
+	_, o = replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Prune = true
+	err = o.Run()
+	require.NoError(t, err, "failed to prune")
+
+	expected := []string{
+		filepath.Join(o.NamespacesDir, "jx-production", "lighthouse", "lighthouse-oauth-token.yaml"),
+		filepath.Join(o.NamespacesDir, "jx-production", "lighthouse", "lighthouse-hmac-token.yaml"),
+		filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-hmac-token.yaml"),
+	}
+	assert.ElementsMatch(t, expected, o.Pruned, "pruned files")
+	assert.FileExists(t, filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-oauth-token.yaml"), "should have kept the replica")
+}
+
+func TestReplicatePruneKeepsReplicasOfOtherNamespaces(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceData := "test_data"
+	err := files.CopyDirOverwrite(sourceData, tmpDir)
+	require.NoError(t, err, "failed to copy generated crds at %s to %s", sourceData, tmpDir)
+
+	_, o := replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Name = []string{"lighthouse-oauth-token"}
+	err = o.Run()
+	require.NoError(t, err, "failed to replicate")
+
+	// a replica of an ExternalSecret in another namespace and a replica without a source
+	replicaFile := filepath.Join(o.NamespacesDir, "jx-staging", "lighthouse", "lighthouse-oauth-token.yaml")
+	es := &v1.ExternalSecret{}
+	err = yamls.LoadFile(replicaFile, es)
+	require.NoError(t, err, "failed to load file %s", replicaFile)
+
+	otherFile := filepath.Join(o.NamespacesDir, "jx-production", "other", "my-secret.yaml")
+	es.Name = "my-secret"
+	es.Namespace = "jx-production"
+	es.Annotations[extsecrets.ReplicaSourceAnnotation] = "jx-other/my-secret"
+	require.NoError(t, os.MkdirAll(filepath.Dir(otherFile), files.DefaultDirWritePermissions))
+	err = yamls.SaveFile(es, otherFile)
+	require.NoError(t, err, "failed to save file %s", otherFile)
+
+	legacyFile := filepath.Join(o.NamespacesDir, "jx-production", "other", "legacy-secret.yaml")
+	es.Name = "legacy-secret"
+	delete(es.Annotations, extsecrets.ReplicaSourceAnnotation)
+	err = yamls.SaveFile(es, legacyFile)
+	require.NoError(t, err, "failed to save file %s", legacyFile)
+
+	_, o = replicate.NewCmdReplicate()
+	o.Dir = tmpDir
+	o.Prune = true
+	err = o.Run()
+	require.NoError(t, err, "failed to prune")
+
+	assert.Empty(t, o.Pruned, "pruned files")
+	assert.FileExists(t, otherFile, "should have kept the replica of the other namespace")
+	assert.FileExists(t, legacyFile, "should have kept the replica without a source")
+	assert.FileExists(t, replicaFile, "should have kept the replica")
+}
@@ -0,0 +1,410 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input/survey"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	cmdLong = templates.LongDesc(`
+		Restores the values from an encrypted archive created by the backup command into the underlying secret storage
+
+		The values are matched to the ExternalSecrets in the cluster by namespace, name and entry so that the keys in the secret storage are those used by the ExternalSecrets. Use --to-backend-type to restore the values to a different backend type than the ExternalSecrets use.
+
+		The differences between the archive and the secret storage are shown first. Values are never displayed; hashes of the values using a random key for each run are shown instead so they can only be compared within the output. Use --dry-run to only show the differences.
+`)
+
+	cmdExample = templates.Examples(`
+		# show the values which would be restored from an age archive
+		%s restore --file secrets-backup.age --age-identity key.txt --dry-run
+
+		# restore the values from a GPG archive without prompting
+		%s restore --file secrets-backup.asc --batch-mode
+
+		# restore the values into Kubernetes Secrets rather than the backend type of the ExternalSecrets
+		%s restore --file secrets-backup.age --age-identity key.txt --to-backend-type local
+	`)
+)
+
+// Status the kind of change to a value in the secret store
+type Status string
+
+const (
+	// StatusAdded the value is not in the secret store
+	StatusAdded Status = "added"
+
+	// StatusChanged the value in the secret store differs from the archive
+	StatusChanged Status = "changed"
+
+	// StatusUnchanged the value in the secret store is the same as the archive
+	StatusUnchanged Status = "unchanged"
+)
+
+// Options the options for the command
+type Options struct {
+	secretfacade.Options
+	backups.Encrypter
+
+	File          string
+	ToBackendType string
+	DryRun        bool
+	Input         input.Interface
+	Audit         audit.Options
+	Results       []*Change
+
+	secretManagers populate.SecretManagers
+	hasher         *masker.Hasher
+}
+
+// Change a change to a value in the secret store
+type Change struct {
+	// Namespace the namespace of the ExternalSecret
+	Namespace string
+
+	// Name the name of the ExternalSecret
+	Name string
+
+	// Entry the name of the entry in the Kubernetes Secret
+	Entry string
+
+	// BackendType the backend type to write to
+	BackendType string
+
+	// Location the location in the secret store
+	Location string
+
+	// Key the key in the secret store
+	Key string
+
+	// Property the property of the key in the secret store
+	Property string
+
+	// Status the kind of change
+	Status Status
+
+	// CurrentHash the keyed hash of the value in the secret store
+	CurrentHash string
+
+	// BackupHash the keyed hash of the value in the archive
+	BackupHash string
+
+	externalSecret *v1.ExternalSecret
+	value          string
+}
+
+// NewCmdRestore creates a command object for the command
+func NewCmdRestore() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "restore",
+		Short:   "Restores the values from an encrypted archive created by the backup command into the underlying secret storage",
+		Long:    cmdLong,
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "the namespace to filter the ExternalSecret resources")
+	cmd.Flags().StringVarP(&o.File, "file", "", "", "the archive file created by the backup command")
+	cmd.Flags().StringVarP(&o.ToBackendType, "to-backend-type", "", "", "the backend type to restore the values to. Defaults to the backend type of each ExternalSecret")
+	cmd.Flags().BoolVarP(&o.DryRun, "dry-run", "", false, "only shows the differences between the archive and the secret storage")
+	o.Encrypter.AddDecryptFlags(cmd)
+	o.Audit.AddFlags(cmd)
+	o.Options.AddFlags(cmd)
+	return cmd, o
+}
+
+// Validate validates the options
+func (o *Options) Validate() error {
+	if o.File == "" {
+		return errors.Errorf("missing --file for the archive to restore")
+	}
+	return o.Options.Validate()
+}
+
+// Run implements the command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return errors.Wrap(err, "error validating options")
+	}
+
+	data, err := o.Decrypt(o.File)
+	if err != nil {
+		return err
+	}
+	archive, err := backups.ParseArchive(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load archive %s", o.File)
+	}
+
+	pairs, err := o.Load()
+	if err != nil {
+		return errors.Wrap(err, "failed to load ExternalSecret and Secret pairs")
+	}
+	o.hasher, err = masker.NewHasher()
+	if err != nil {
+		return err
+	}
+
+	changes, err := o.findChanges(archive, pairs)
+	if err != nil {
+		return err
+	}
+	o.Results = changes
+
+	var modified []*Change
+	for _, c := range changes {
+		if c.Status != StatusUnchanged {
+			modified = append(modified, c)
+		}
+	}
+	if len(modified) == 0 {
+		log.Logger().Infof("the %d values in the archive are the same as the secret store", len(changes))
+		return nil
+	}
+
+	t := table.CreateTable(os.Stdout)
+	t.AddRow("SECRET", "ENTRY", "BACKEND", "KEY", "CHANGE", "STORE", "ARCHIVE")
+	for _, c := range modified {
+		t.AddRow(c.Namespace+"/"+c.Name, c.Entry, c.BackendType, c.Key, termcolor.ColorWarning(string(c.Status)), c.CurrentHash, c.BackupHash)
+	}
+	t.Render()
+	if o.DryRun {
+		log.Logger().Infof("dry run so not restoring %d values", len(modified))
+		return nil
+	}
+
+	if !o.BatchMode {
+		if o.Input == nil {
+			o.Input = survey.NewInput()
+		}
+		flag, err := o.Input.Confirm(fmt.Sprintf("do you want to restore %d values", len(modified)), false, "the values in the secret store will be replaced by the values in the archive")
+		if err != nil {
+			return errors.Wrap(err, "failed to confirm restore")
+		}
+		if !flag {
+			log.Logger().Infof("not restoring the values")
+			return nil
+		}
+	}
+	return o.write(modified, changes)
+}
+
+// findChanges compares the values in the archive with the secret store
+func (o *Options) findChanges(archive *backups.Archive, pairs []*secretfacade.SecretPair) ([]*Change, error) {
+	secrets := map[string]*secretfacade.SecretPair{}
+	for _, r := range pairs {
+		secrets[r.Key()] = r
+	}
+
+	var answer []*Change
+	found := map[string]*Change{}
+	for _, e := range archive.Entries {
+		if o.Namespace != "" && e.Namespace != o.Namespace {
+			continue
+		}
+		c, err := o.createChange(e, secrets[e.SecretKey()])
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			continue
+		}
+
+		// lets skip values for keys shared by several ExternalSecrets which are already restored
+		id := c.BackendType + "/" + c.Location + "/" + c.Key + "/" + c.Property
+		existing := found[id]
+		if existing != nil {
+			if existing.value != c.value {
+				log.Logger().Warnf("ignoring the value of %s for key %s property %s as it differs from the value of %s/%s", e.SecretKey(), c.Key, c.Property, existing.Namespace, existing.Name)
+			}
+			continue
+		}
+		found[id] = c
+		answer = append(answer, c)
+	}
+	return answer, nil
+}
+
+// createChange creates the change for an entry in the archive using the ExternalSecret if it exists
+func (o *Options) createChange(e *backups.Entry, r *secretfacade.SecretPair) (*Change, error) {
+	c := &Change{
+		Namespace:   e.Namespace,
+		Name:        e.ExternalSecret,
+		Entry:       e.Name,
+		BackendType: e.BackendType,
+		Location:    e.Location,
+		Key:         e.Key,
+		Property:    e.Property,
+		BackupHash:  o.hasher.Hash(e.Value),
+		value:       e.Value,
+	}
+	if r == nil {
+		if o.HasFilters() {
+			return nil, nil
+		}
+		if o.ToBackendType != "" && o.ToBackendType != e.BackendType {
+			log.Logger().Warnf("cannot restore %s entry %s to backend type %s as there is no ExternalSecret", e.SecretKey(), e.Name, o.ToBackendType)
+			return nil, nil
+		}
+	} else {
+		if !o.Matches(r) {
+			return nil, nil
+		}
+		es := r.ExternalSecret
+		if o.ToBackendType != "" {
+			es.Spec.BackendType = o.ToBackendType
+		}
+		var d *v1.Data
+		for i := range es.Spec.Data {
+			if es.Spec.Data[i].Name == e.Name {
+				d = &es.Spec.Data[i]
+				break
+			}
+		}
+		if d == nil {
+			log.Logger().Warnf("cannot restore %s entry %s as the ExternalSecret no longer has the entry", e.SecretKey(), e.Name)
+			return nil, nil
+		}
+		c.externalSecret = &es
+		c.BackendType = es.Spec.BackendType
+		c.Location = populate.GetExternalSecretLocation(&es)
+		c.Key = populate.GetSecretKey(v1alpha1.BackendType(es.Spec.BackendType), es.Name, d.Key)
+		c.Property = d.Property
+	}
+
+	secretManager, err := o.getSecretManager(c.BackendType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create a secret manager for backend type %s", c.BackendType)
+	}
+	current, err := secretManager.GetSecret(c.Location, c.Key, c.Property)
+	if err != nil {
+		if !editor.IsSecretNotFound(err) {
+			return nil, errors.Wrapf(err, "failed to get key %s property %s from the secret store", c.Key, c.Property)
+		}
+		log.Logger().Debugf("key %s property %s is not in the secret store: %s", c.Key, c.Property, err.Error())
+		current = ""
+	}
+	c.CurrentHash = o.hasher.Hash(current)
+	switch current {
+	case "":
+		c.Status = StatusAdded
+	case c.value:
+		c.Status = StatusUnchanged
+	default:
+		c.Status = StatusChanged
+	}
+	return c, nil
+}
+
+// write writes the changed values merging the properties of each key with all the archive values for the key
+func (o *Options) write(changes, archived []*Change) error {
+	auditor, err := o.Audit.NewAuditor("restore", o.KubeClient)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the auditor")
+	}
+
+	var keys []string
+	m := map[string][]*Change{}
+	for _, c := range changes {
+		id := c.BackendType + "/" + c.Location + "/" + c.Key
+		if len(m[id]) == 0 {
+			keys = append(keys, id)
+		}
+		m[id] = append(m[id], c)
+	}
+	archiveProperties := map[string][]string{}
+	for _, c := range archived {
+		id := c.BackendType + "/" + c.Location + "/" + c.Key
+		pv := editor.PropertyValue{Property: c.Property, Name: c.Entry}
+		archiveProperties[id] = append(archiveProperties[id], pv.PropertyName())
+	}
+	for _, id := range keys {
+		keyChanges := m[id]
+		first := keyChanges[0]
+		secretManager, err := o.getSecretManager(first.BackendType)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create a secret manager for backend type %s", first.BackendType)
+		}
+
+		var annotations, labels map[string]string
+		var secretType corev1.SecretType
+		properties := archiveProperties[id]
+		if first.externalSecret != nil {
+			es := first.externalSecret
+			annotations = es.Spec.Template.Metadata.Annotations
+			labels = es.Spec.Template.Metadata.Labels
+			secretType = corev1.SecretType(es.Spec.Template.Type)
+			for i := range es.Spec.Data {
+				d := &es.Spec.Data[i]
+				if populate.GetSecretKey(v1alpha1.BackendType(es.Spec.BackendType), es.Name, d.Key) == first.Key {
+					pv := editor.PropertyValue{Property: d.Property, Name: d.Name}
+					properties = append(properties, pv.PropertyName())
+				}
+			}
+		}
+
+		var values []editor.PropertyValue
+		e := &audit.Event{
+			Namespace:      first.Namespace,
+			ExternalSecret: first.Name,
+			Backend:        first.BackendType,
+			Location:       first.Location,
+			Key:            first.Key,
+		}
+		for _, c := range keyChanges {
+			pv := editor.PropertyValue{Property: c.Property, Name: c.Entry, Value: c.value}
+			values = append(values, pv)
+			e.Properties = append(e.Properties, auditor.Property(pv.PropertyName(), c.value, audit.SourceRestore))
+		}
+		backendType := v1alpha1.BackendType(first.BackendType)
+		mw := &editor.MergeWrite{
+			Store:      secretManager,
+			Location:   first.Location,
+			Key:        first.Key,
+			Properties: properties,
+			Changed:    values,
+			CreateSecretValue: func(values []editor.PropertyValue) secretstore.SecretValue {
+				return populate.CreateSecretValue(backendType, values, annotations, labels, secretType)
+			},
+		}
+		err = mw.Write()
+		if err != nil {
+			return errors.Wrapf(err, "failed to restore key %s for ExternalSecret %s/%s", first.Key, first.Namespace, first.Name)
+		}
+		err = auditor.Record(e)
+		if err != nil {
+			log.Logger().Warnf("%s", err.Error())
+		}
+	}
+	log.Logger().Infof("restored %d values from %s", len(changes), termcolor.ColorInfo(o.File))
+	return nil
+}
+
+func (o *Options) getSecretManager(backendType string) (secretstore.Interface, error) {
+	return o.secretManagers.Get(o.SecretStoreManagerFactory, o.KubeClient, backendType)
+}
@@ -0,0 +1,233 @@
+package restore_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/audit"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/backups/testbackups"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/restore"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	secretstorefake "github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestore(t *testing.T) {
+	var err error
+	ns := "jx"
+	location := "my-project"
+	backendType := "gcpSecretsManager"
+	tmpDir := t.TempDir()
+
+	archive := &backups.Archive{
+		Version: backups.ArchiveVersion,
+		Entries: []*backups.Entry{
+			{Namespace: ns, ExternalSecret: "jx-basic-auth", Name: "username", BackendType: backendType, Location: location, Key: "jx-basic-auth", Property: "username", Value: "admin"},
+			{Namespace: ns, ExternalSecret: "jx-basic-auth", Name: "password", BackendType: backendType, Location: location, Key: "jx-basic-auth", Property: "password", Value: "old-password"},
+			{Namespace: ns, ExternalSecret: "lighthouse-oauth-token", Name: "oauth", BackendType: backendType, Location: location, Key: "lighthouse-oauth-token", Property: "token", Value: "my-oauth-token"},
+			{Namespace: ns, ExternalSecret: "lighthouse-oauth-token", Name: "hmac", BackendType: backendType, Location: location, Key: "lighthouse-hmac-token", Property: "token", Value: "my-hmac-token"},
+		},
+	}
+	archiveFile := writeArchive(t, tmpDir, archive)
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	_, err = fakeFactory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	fakeStore := fakeFactory.GetSecretStore()
+	err = fakeStore.SetSecret(location, "jx-basic-auth", &secretstore.SecretValue{PropertyValues: map[string]string{
+		"username": "admin",
+		"password": "new-password",
+	}})
+	require.NoError(t, err)
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+	secretClient, err := extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	newOptions := func() *restore.Options {
+		_, o := restore.NewCmdRestore()
+		o.Namespace = ns
+		o.File = archiveFile
+		o.AgeIdentities = []string{"key.txt"}
+		o.Encrypter.CommandRunner = testbackups.NewFakeAgeRunner(t)
+		o.KubeClient = fake.NewSimpleClientset()
+		o.SecretClient = secretClient
+		o.SecretStoreManagerFactory = fakeFactory
+		o.BatchMode = true
+		return o
+	}
+
+	o := newOptions()
+	o.DryRun = true
+	err = o.Run()
+	require.NoError(t, err, "failed to run restore --dry-run")
+
+	statuses := map[string]restore.Status{}
+	for _, c := range o.Results {
+		statuses[c.Name+"/"+c.Entry] = c.Status
+	}
+	assert.Equal(t, map[string]restore.Status{
+		"jx-basic-auth/username":       restore.StatusUnchanged,
+		"jx-basic-auth/password":       restore.StatusChanged,
+		"lighthouse-oauth-token/oauth": restore.StatusAdded,
+		"lighthouse-oauth-token/hmac":  restore.StatusAdded,
+	}, statuses, "statuses")
+
+	value, err := fakeStore.GetSecret(location, "jx-basic-auth", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "new-password", value, "dry run should not modify the secret store")
+
+	auditFile := filepath.Join(tmpDir, "audit.jsonl")
+	o = newOptions()
+	o.Audit.File = auditFile
+	err = o.Run()
+	require.NoError(t, err, "failed to run restore")
+
+	expected := map[string]map[string]string{
+		"jx-basic-auth": {
+			"username": "admin",
+			"password": "old-password",
+		},
+		"lighthouse-oauth-token": {
+			"token": "my-oauth-token",
+		},
+		"lighthouse-hmac-token": {
+			"token": "my-hmac-token",
+		},
+	}
+	for key, properties := range expected {
+		for property, expectedValue := range properties {
+			value, err := fakeStore.GetSecret(location, key, property)
+			require.NoError(t, err, "failed to get key %s property %s", key, property)
+			assert.Equal(t, expectedValue, value, "key %s property %s", key, property)
+		}
+	}
+
+	auditData, err := os.ReadFile(auditFile)
+	require.NoError(t, err, "failed to read audit log %s", auditFile)
+	keys := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(auditData)), "\n") {
+		e := &audit.Event{}
+		err = json.Unmarshal([]byte(line), e)
+		require.NoError(t, err, "failed to parse audit event %s", line)
+		assert.Equal(t, "jx-secret restore", e.Command, "command for key %s", e.Key)
+		for _, p := range e.Properties {
+			assert.Equal(t, audit.SourceRestore, p.Source, "source of key %s property %s", e.Key, p.Name)
+		}
+		keys[e.Key] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"jx-basic-auth":          true,
+		"lighthouse-oauth-token": true,
+		"lighthouse-hmac-token":  true,
+	}, keys, "audited keys")
+
+	o = newOptions()
+	err = o.Run()
+	require.NoError(t, err, "failed to run restore again")
+	for _, c := range o.Results {
+		assert.Equal(t, restore.StatusUnchanged, c.Status, "status of %s/%s after restoring", c.Name, c.Entry)
+	}
+}
+
+func TestRestoreDeletedExternalSecret(t *testing.T) {
+	var err error
+	ns := "jx"
+	location := "my-project"
+	backendType := "gcpSecretsManager"
+	key := "old-registry"
+
+	archiveFile := writeArchive(t, t.TempDir(), &backups.Archive{
+		Version: backups.ArchiveVersion,
+		Entries: []*backups.Entry{
+			{Namespace: ns, ExternalSecret: key, Name: "username", BackendType: backendType, Location: location, Key: key, Property: "username", Value: "admin"},
+			{Namespace: ns, ExternalSecret: key, Name: "password", BackendType: backendType, Location: location, Key: key, Property: "password", Value: "old-password"},
+		},
+	})
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	_, err = fakeFactory.NewSecretManager(secretstore.SecretStoreTypeGoogle)
+	require.NoError(t, err)
+	fakeStore := fakeFactory.GetSecretStore()
+	err = fakeStore.SetSecret(location, key, &secretstore.SecretValue{PropertyValues: map[string]string{
+		"username": "admin",
+		"password": "new-password",
+	}})
+	require.NoError(t, err)
+
+	secretClient, err := extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme()))
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	_, o := restore.NewCmdRestore()
+	o.Namespace = ns
+	o.File = archiveFile
+	o.AgeIdentities = []string{"key.txt"}
+	o.Encrypter.CommandRunner = testbackups.NewFakeAgeRunner(t)
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretClient = secretClient
+	o.SecretStoreManagerFactory = fakeFactory
+	o.BatchMode = true
+	err = o.Run()
+	require.NoError(t, err, "failed to run restore")
+
+	for property, expectedValue := range map[string]string{"username": "admin", "password": "old-password"} {
+		value, err := fakeStore.GetSecret(location, key, property)
+		require.NoError(t, err, "failed to get key %s property %s", key, property)
+		assert.Equal(t, expectedValue, value, "key %s property %s", key, property)
+	}
+}
+
+func writeArchive(t *testing.T, dir string, archive *backups.Archive) string {
+	data, err := archive.ToJSON()
+	require.NoError(t, err, "failed to marshal archive")
+
+	archiveFile := filepath.Join(dir, "secrets-backup.age")
+	encrypter := &backups.Encrypter{
+		AgeRecipients: []string{"age1dummy"},
+		CommandRunner: testbackups.NewFakeAgeRunner(t),
+	}
+	err = encrypter.Encrypt(data, archiveFile)
+	require.NoError(t, err, "failed to encrypt archive")
+	return archiveFile
+}
+
+func TestRestoreFailsOnSecretStoreError(t *testing.T) {
+	var err error
+	ns := "jx"
+
+	archiveFile := writeArchive(t, t.TempDir(), &backups.Archive{
+		Version: backups.ArchiveVersion,
+		Entries: []*backups.Entry{
+			{Namespace: ns, ExternalSecret: "jx-basic-auth", Name: "username", BackendType: "gcpSecretsManager", Location: "my-project", Key: "jx-basic-auth", Property: "username", Value: "admin"},
+		},
+	})
+
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	secretClient, err := extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...))
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	_, o := restore.NewCmdRestore()
+	o.Namespace = ns
+	o.File = archiveFile
+	o.AgeIdentities = []string{"key.txt"}
+	o.Encrypter.CommandRunner = testbackups.NewFakeAgeRunner(t)
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretClient = secretClient
+	o.SecretStoreManagerFactory = &testsecrets.FailingSecretManagerFactory{Err: errors.New("permission denied")}
+	o.BatchMode = true
+	err = o.Run()
+	require.Error(t, err, "should fail to restore when the secret store fails")
+	assert.Contains(t, err.Error(), "permission denied", "error")
+	assert.Empty(t, o.Results, "should not report any changes")
+}
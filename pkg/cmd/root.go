@@ -1,12 +1,17 @@
 package cmd
 
 import (
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/backup"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/convert"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/copy"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/dedupe"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/diff"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/edit"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/mask"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/plugins"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/replicate"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/restore"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/vault"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/verify"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/version"
@@ -36,11 +41,16 @@ func Main() *cobra.Command {
 			}
 		},
 	}
+	cmd.AddCommand(cobras.SplitCommand(backup.NewCmdBackup()))
 	cmd.AddCommand(cobras.SplitCommand(convert.NewCmdSecretConvert()))
 	cmd.AddCommand(cobras.SplitCommand(copy.NewCmdCopy()))
+	cmd.AddCommand(cobras.SplitCommand(dedupe.NewCmdDedupe()))
+	cmd.AddCommand(cobras.SplitCommand(diff.NewCmdDiff()))
 	cmd.AddCommand(cobras.SplitCommand(edit.NewCmdEdit()))
+	cmd.AddCommand(cobras.SplitCommand(mask.NewCmdMask()))
 	cmd.AddCommand(helper.RetryOnErrorCommand(cobras.SplitCommand(populate.NewCmdPopulate()), helper.RegexRetryFunction(secretRetriableErrors)))
 	cmd.AddCommand(cobras.SplitCommand(replicate.NewCmdReplicate()))
+	cmd.AddCommand(cobras.SplitCommand(restore.NewCmdRestore()))
 	cmd.AddCommand(cobras.SplitCommand(verify.NewCmdVerify()))
 	cmd.AddCommand(cobras.SplitCommand(version.NewCmdVersion()))
 	cmd.AddCommand(cobras.SplitCommand(wait.NewCmdWait()))
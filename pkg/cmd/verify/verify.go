@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
@@ -13,15 +15,24 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 var (
 	verifyLong = templates.LongDesc(`
 		Verifies that the ExternalSecret resources have the required properties populated in the underlying secret storage
+
+		Populated values are also validated against the pattern, minimum length, maximum length and format of the property in the secret schema. Values are never displayed.
+
+		The status and last sync age reported by the ExternalSecret controller are also shown. Any ExternalSecrets which the controller failed to synchronise, or whose latest generation has not been observed by the controller, are listed separately.
 `)
 
 	verifyExample = templates.Examples(`
+		# verify all the secrets
 		%s verify
+
+		# verify the mandatory secrets stored in Google Secret Manager
+		%s verify --mandatory --backend-type gcpSecretsManager
 	`)
 )
 
@@ -29,7 +40,9 @@ var (
 type Options struct {
 	secretfacade.Options
 
-	Results []*secretfacade.SecretError
+	Results       []*secretfacade.SecretError
+	SyncResults   []*secretfacade.SyncError
+	InvalidValues []*secretfacade.SecretPair
 }
 
 // NewCmdVerify creates a command object for the command
@@ -41,7 +54,7 @@ func NewCmdVerify() (*cobra.Command, *Options) {
 		Aliases: []string{"get"},
 		Short:   "Verifies that the ExternalSecret resources have the required properties populated in the underlying secret storage",
 		Long:    verifyLong,
-		Example: fmt.Sprintf(verifyExample, rootcmd.BinaryName),
+		Example: fmt.Sprintf(verifyExample, rootcmd.BinaryName, rootcmd.BinaryName),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := o.Run()
 			helper.CheckErr(err)
@@ -64,10 +77,15 @@ func (o *Options) Run() error {
 		return errors.Wrap(err, "failed to verify secrets")
 	}
 	o.Results = nil
+	o.SyncResults = nil
+	o.InvalidValues = nil
 
 	t := table.CreateTable(os.Stdout)
-	t.AddRow("SECRET", "STATUS")
+	t.AddRow("SECRET", "STATUS", "SYNC", "LAST SYNC")
 	for _, r := range pairs {
+		if !o.Matches(r) {
+			continue
+		}
 		name := r.ExternalSecret.Name
 		state := r.Error
 		ns := r.ExternalSecret.Namespace
@@ -75,15 +93,51 @@ func (o *Options) Run() error {
 		if ns != "" && o.Namespace == "" {
 			fullName = ns + "/" + name
 		}
-		if state == nil {
-			t.AddRow(fullName, termcolor.ColorInfo(fmt.Sprintf("valid: %s", strings.Join(r.ExternalSecret.KeyAndNames(), ", "))))
-		} else {
+		syncStatus := secretfacade.SyncStatus(&r.ExternalSecret)
+		if r.SyncError != nil {
+			o.SyncResults = append(o.SyncResults, r.SyncError)
+			syncStatus = termcolor.ColorWarning(syncStatus)
+		}
+		lastSync := lastSyncAge(&r.ExternalSecret)
+		if state == nil && len(r.ValueErrors) == 0 {
+			t.AddRow(fullName, termcolor.ColorInfo(fmt.Sprintf("valid: %s", strings.Join(r.ExternalSecret.KeyAndNames(), ", "))), syncStatus, lastSync)
+			continue
+		}
+		if state != nil {
 			o.Results = append(o.Results, state)
 			for _, e := range state.EntryErrors {
-				t.AddRow(fullName, termcolor.ColorWarning(fmt.Sprintf("key %s missing properties: %s", e.Key, strings.Join(e.Properties, ", "))))
+				t.AddRow(fullName, termcolor.ColorWarning(fmt.Sprintf("key %s missing properties: %s", e.Key, strings.Join(e.Properties, ", "))), syncStatus, lastSync)
+			}
+		}
+		if len(r.ValueErrors) > 0 {
+			o.InvalidValues = append(o.InvalidValues, r)
+			for _, e := range r.ValueErrors {
+				t.AddRow(fullName, termcolor.ColorWarning(fmt.Sprintf("entry %s value %s", e.Name, strings.Join(e.Messages, ", "))), syncStatus, lastSync)
 			}
 		}
 	}
 	t.Render()
+
+	if len(o.SyncResults) > 0 {
+		fmt.Fprintf(os.Stdout, "\nExternalSecrets not synchronised by the controller:\n")
+		t = table.CreateTable(os.Stdout)
+		t.AddRow("SECRET", "SYNC ERROR")
+		for _, e := range o.SyncResults {
+			fullName := e.ExternalSecret.Name
+			if e.ExternalSecret.Namespace != "" && o.Namespace == "" {
+				fullName = e.ExternalSecret.Namespace + "/" + fullName
+			}
+			t.AddRow(fullName, termcolor.ColorWarning(e.Message()))
+		}
+		t.Render()
+	}
 	return nil
 }
+
+// lastSyncAge returns the age of the last sync by the controller
+func lastSyncAge(es *v1.ExternalSecret) string {
+	if es.Status == nil || es.Status.LastSync.IsZero() {
+		return ""
+	}
+	return duration.HumanDuration(time.Since(es.Status.LastSync.Time))
+}
@@ -1,6 +1,7 @@
 package verify_test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/verify"
@@ -61,4 +62,68 @@ func TestVerify(t *testing.T) {
 			}
 		}
 	}
+	require.Len(t, o.SyncResults, 1, "sync results")
+	syncError := o.SyncResults[0]
+	assert.Equal(t, "knative-docker-user-pass", syncError.ExternalSecret.Name, "sync error name")
+	assert.True(t, syncError.Failed, "sync error should be failed")
+	assert.False(t, syncError.Stale, "sync error should not be stale")
+}
+
+func TestVerifyValues(t *testing.T) {
+	var err error
+	_, o := verify.NewCmdVerify()
+	ns := "jx"
+
+	kubeObjects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "jx-basic-auth",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"username": []byte("a-very-long-username"),
+				"password": []byte("pw123"),
+				"url":      []byte("http://"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "lighthouse-oauth-token",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"oauth": []byte("abcdef0123456789"),
+			},
+		},
+	}
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, filepath.Join("test_data", "values"))
+	fakeDynClient := testsecrets.NewFakeDynClient(runtime.NewScheme(), dynObjects...)
+
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	o.Namespace = ns
+	o.KubeClient = fake.NewSimpleClientset(kubeObjects...)
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run verify")
+
+	assert.Empty(t, o.Results, "should have no missing properties")
+	require.Len(t, o.InvalidValues, 1, "invalid values")
+
+	r := o.InvalidValues[0]
+	assert.Equal(t, "jx-basic-auth", r.Name(), "invalid secret name")
+
+	messages := map[string][]string{}
+	for _, e := range r.ValueErrors {
+		messages[e.Name] = e.Messages
+		for _, m := range e.Messages {
+			for _, value := range kubeObjects[0].(*corev1.Secret).Data {
+				assert.NotContains(t, m, string(value), "message for %s should not contain the value", e.Name)
+			}
+		}
+	}
+	assert.Equal(t, []string{"is longer than the maximum length of 10"}, messages["username"], "username")
+	assert.Equal(t, []string{"is shorter than the minimum length of 8"}, messages["password"], "password")
+	assert.Equal(t, []string{"does not match the pattern ^https://", "is not an absolute URL for format url"}, messages["url"], "url")
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/rootcmd"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
@@ -18,10 +19,22 @@ import (
 var (
 	cmdLong = templates.LongDesc(`
 		Waits for the mandatory Secrets to be populated from their External Secrets
+
+		The ExternalSecret and Secret resources are watched so that changes are detected as soon as they happen.
+		If the ExternalSecret resources cannot be watched, such as when reading them from the filesystem, they are polled instead.
+
+		By default all the mandatory secrets are waited for. If any of the --filter, --selector, --name, --name-regex, --namespace-glob, --backend-type, --schema-object or --schema-label filters are specified then only the ExternalSecrets matching all of the filters are waited for whether they are mandatory or not.
 `)
 
 	cmdExample = templates.Examples(`
+		# waits for the mandatory secrets
 		%s wait
+
+		# waits for the lighthouse secrets to be populated and synchronised by the ExternalSecret controller
+		%s wait --name 'lighthouse-*' --synced
+
+		# waits for the secrets with a label
+		%s wait --selector app=tekton --namespace-glob 'jx-*'
 	`)
 )
 
@@ -31,6 +44,7 @@ type Options struct {
 
 	Timeout       time.Duration
 	PollPeriod    time.Duration
+	Synced        bool
 	Results       []*secretfacade.SecretError
 	messages      map[string]string
 	loggedMissing bool
@@ -44,15 +58,18 @@ func NewCmdWait() (*cobra.Command, *Options) {
 		Use:     "wait",
 		Short:   "Waits for the mandatory Secrets to be populated from their External Secrets",
 		Long:    cmdLong,
-		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName),
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
 		Run: func(cmd *cobra.Command, args []string) {
 			err := o.Run()
 			helper.CheckErr(err)
 		},
 	}
 	cmd.Flags().StringVarP(&o.Namespace, "ns", "n", "", "the namespace to filter the ExternalSecret resources")
+	cmd.Flags().StringVarP(&o.Dir, "dir", "d", ".", "the directory to look for the jx-requirements.yml file used to evaluate the requires expressions of the secret schemas")
 	cmd.Flags().DurationVarP(&o.Timeout, "timeout", "t", 30*time.Minute, "the maximum amount of time to wait for the secrets to be valid")
-	cmd.Flags().DurationVarP(&o.PollPeriod, "poll", "p", 2*time.Second, "the polling period to check if the secrets are valid")
+	cmd.Flags().DurationVarP(&o.PollPeriod, "poll", "p", 2*time.Second, "the polling period to check if the secrets are valid if the ExternalSecrets cannot be watched")
+	cmd.Flags().BoolVarP(&o.Synced, "synced", "", false, "also waits for the ExternalSecret controller to report the status "+extsecrets.StatusSuccess)
+	o.Options.AddFlags(cmd)
 	return cmd, o
 }
 
@@ -63,8 +80,27 @@ func (o *Options) Run() error {
 		return errors.Wrap(err, "error validating options")
 	}
 
-	endTime := time.Now().Add(o.Timeout)
-	log.Logger().Infof("waiting for the mandatory Secrets to be populated from ExternalSecrets...")
+	timeout := time.NewTimer(o.Timeout)
+	defer timeout.Stop()
+
+	// lets use informers to react to changes rather than polling if the client supports it
+	stop := make(chan struct{})
+	defer close(stop)
+	changed := make(chan struct{}, 1)
+	watching, err := o.StartInformers(stop, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch the ExternalSecrets and Secrets")
+	}
+	if !watching {
+		log.Logger().Debugf("polling every %s as the ExternalSecrets cannot be watched", o.PollPeriod.String())
+	}
+
+	log.Logger().Infof("waiting for the %s Secrets to be populated from ExternalSecrets...", o.description())
 	for {
 		valid, err := o.WaitCheck()
 		if err != nil {
@@ -73,16 +109,26 @@ func (o *Options) Run() error {
 		if valid {
 			return nil
 		}
-		now := time.Now()
-		if now.After(endTime) {
+
+		var poll <-chan time.Time
+		if !watching {
+			poll = time.After(o.PollPeriod)
+		}
+		select {
+		case <-changed:
+		case <-poll:
+		case <-timeout.C:
 			return errors.Errorf("timed out waiting for the Secrets to be valid from the ExternalSecrets after waiting %s", o.Timeout.String())
 		}
-		time.Sleep(o.PollPeriod)
 	}
 }
 
-// Run implements the command
+// WaitCheck loads the secrets and returns true if all the matching secrets are valid
 func (o *Options) WaitCheck() (bool, error) {
+	err := o.SecretFilter.Validate()
+	if err != nil {
+		return false, err
+	}
 	pairs, err := o.Load()
 	if err != nil {
 		return false, errors.Wrap(err, "failed to verify secrets")
@@ -95,7 +141,7 @@ func (o *Options) WaitCheck() (bool, error) {
 			continue
 		}
 		count++
-		state, err := secretfacade.VerifySecret(&r.ExternalSecret, r.Secret)
+		state, err := o.VerifyRequired(r)
 		if err != nil {
 			return false, errors.Wrapf(err, "failed to verify secret")
 		}
@@ -112,6 +158,9 @@ func (o *Options) WaitCheck() (bool, error) {
 				buf.WriteString(fmt.Sprintf("key %s missing properties: %s", e.Key, strings.Join(e.Properties, ", ")))
 			}
 			o.logMessage(name, termcolor.ColorWarning(buf.String()))
+		} else if o.Synced && !secretfacade.IsSynced(&r.ExternalSecret) {
+			valid = false
+			o.logMessage(name, termcolor.ColorWarning(fmt.Sprintf("waiting for status %s but was: %s", extsecrets.StatusSuccess, secretfacade.SyncStatus(&r.ExternalSecret))))
 		} else {
 			o.logMessage(name, termcolor.ColorInfo(fmt.Sprintf("valid: %s", strings.Join(r.ExternalSecret.KeyAndNames(), ", "))))
 		}
@@ -119,19 +168,30 @@ func (o *Options) WaitCheck() (bool, error) {
 	if count == 0 {
 		if !o.loggedMissing {
 			o.loggedMissing = true
-			log.Logger().Infof("no mandatory ExternalSecrets found")
+			log.Logger().Infof("no %s ExternalSecrets found", o.description())
 		}
 		return true, nil
 	}
 	if valid {
-		log.Logger().Infof("%d mandatory secrets are valid", count)
+		log.Logger().Infof("%d %s secrets are valid", count, o.description())
 	}
 	return valid, nil
 }
 
-// Matches returns true if the given secret pair matches the predicate
+// Matches returns true if the given secret pair matches the filters or is mandatory if there are no filters
 func (o *Options) Matches(r *secretfacade.SecretPair) bool {
-	return r.IsMandatory()
+	if !o.HasFilters() {
+		return r.IsMandatory()
+	}
+	return o.Options.Matches(r)
+}
+
+// description describes the secrets being waited for
+func (o *Options) description() string {
+	if o.HasFilters() {
+		return "matching"
+	}
+	return "mandatory"
 }
 
 // logMessage lets log a message if the message has changed for the given secret name
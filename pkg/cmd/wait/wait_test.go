@@ -2,17 +2,23 @@ package wait_test
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
+	schema "github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/wait"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/testsecrets"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
 )
 
 func TestWait(t *testing.T) {
@@ -69,3 +75,206 @@ func TestWait(t *testing.T) {
 	err = o.Run()
 	require.NoError(t, err, "run should not return an error")
 }
+
+func TestWaitForSecretCreatedLater(t *testing.T) {
+	var err error
+	_, o := wait.NewCmdWait()
+	scheme := runtime.NewScheme()
+
+	ns := "jx"
+
+	kubeObjects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "knative-docker-user-pass",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"username": []byte("dummyValue"),
+				"password": []byte("dummyPassword"),
+			},
+		},
+	}
+	dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+	fakeDynClient := testsecrets.NewFakeDynClient(scheme, dynObjects...)
+
+	o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+
+	// lets keep our own reference to the client as the command may replace o.KubeClient while running
+	kubeClient := fake.NewSimpleClientset(kubeObjects...)
+
+	// the informer watches the Secrets once it has synced the initial list
+	watching := make(chan struct{})
+	var watchOnce sync.Once
+	kubeClient.PrependWatchReactor("secrets", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		watchOnce.Do(func() {
+			close(watching)
+		})
+		return false, nil, nil
+	})
+
+	o.Namespace = ns
+	o.KubeClient = kubeClient
+	o.Timeout = 30 * time.Second
+
+	// the poll period is longer than the timeout so only watch events can make the secrets valid
+	o.PollPeriod = time.Hour
+
+	result := make(chan error, 1)
+	go func() {
+		result <- o.Run()
+	}()
+
+	select {
+	case <-watching:
+	case err = <-result:
+		require.Fail(t, "run completed before the Secret was created", "error: %v", err)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "timed out waiting for the Secret informer to sync")
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lighthouse-oauth-token",
+			Namespace: ns,
+		},
+		Data: map[string][]byte{
+			"oauth": []byte("dummyValue"),
+		},
+	}
+	_, err = kubeClient.CoreV1().Secrets(ns).Create(context.TODO(), secret, metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create Secret")
+
+	select {
+	case err = <-result:
+		require.NoError(t, err, "run should not return an error")
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "timed out waiting for the secrets to be valid")
+	}
+}
+
+func TestWaitFilters(t *testing.T) {
+	var err error
+	scheme := runtime.NewScheme()
+	ns := "jx"
+
+	kubeObjects := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "knative-docker-user-pass",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"username": []byte("dummyValue"),
+				"password": []byte("dummyPassword"),
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		setup    func(o *wait.Options)
+		expected bool
+	}{
+		{
+			name: "name glob matching populated secret",
+			setup: func(o *wait.Options) {
+				o.SecretFilter.Names = []string{"knative-*"}
+			},
+			expected: true,
+		},
+		{
+			name: "name glob matching populated secret which is not synced",
+			setup: func(o *wait.Options) {
+				o.SecretFilter.Names = []string{"knative-*"}
+				o.Synced = true
+			},
+			expected: false,
+		},
+		{
+			name: "namespace glob matching missing secret",
+			setup: func(o *wait.Options) {
+				o.SecretFilter.Namespaces = []string{"j*"}
+			},
+			expected: false,
+		},
+		{
+			name: "selector matching no secrets",
+			setup: func(o *wait.Options) {
+				o.SecretFilter.Selector = "gitops.jenkins-x.io/pipeline=cheese"
+			},
+			expected: true,
+		},
+		{
+			name: "selector and name matching populated secret",
+			setup: func(o *wait.Options) {
+				o.SecretFilter.Selector = "gitops.jenkins-x.io/pipeline=environment"
+				o.SecretFilter.Names = []string{"knative-docker-user-pass"}
+			},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		_, o := wait.NewCmdWait()
+		dynObjects := testsecrets.LoadExtSecretDir(t, ns, "test_data")
+		fakeDynClient := testsecrets.NewFakeDynClient(scheme, dynObjects...)
+		o.SecretClient, err = extsecrets.NewClient(fakeDynClient)
+		require.NoError(t, err, "failed to create fake extsecrets Client")
+		o.Namespace = ns
+		o.KubeClient = fake.NewSimpleClientset(kubeObjects...)
+		tc.setup(o)
+
+		valid, err := o.WaitCheck()
+		require.NoError(t, err, "failed to run wait check for %s", tc.name)
+		assert.Equal(t, tc.expected, valid, "valid for %s", tc.name)
+	}
+}
+
+func TestWaitMatchesSchemaLabel(t *testing.T) {
+	var err error
+	_, o := wait.NewCmdWait()
+	o.SecretClient, err = extsecrets.NewClient(testsecrets.NewFakeDynClient(runtime.NewScheme()))
+	require.NoError(t, err, "failed to create fake extsecrets Client")
+	o.KubeClient = fake.NewSimpleClientset()
+	o.SecretFilter.SchemaLabel = "kind=git"
+
+	err = o.Validate()
+	require.NoError(t, err, "failed to validate")
+
+	gitSecret := &secretfacade.SecretPair{}
+	gitSecret.SetSchemaObject(&schema.Object{
+		Properties: []schema.Property{
+			{
+				Name: "username",
+			},
+			{
+				Name: "token",
+				Labels: map[string]string{
+					"kind": "git",
+				},
+			},
+		},
+	})
+	otherSecret := &secretfacade.SecretPair{}
+	otherSecret.SetSchemaObject(&schema.Object{
+		Mandatory: true,
+		Properties: []schema.Property{
+			{
+				Name: "token",
+			},
+		},
+	})
+
+	assert.True(t, o.Matches(gitSecret), "should match the secret with the schema label")
+	assert.False(t, o.Matches(otherSecret), "should not match the mandatory secret without the schema label")
+}
+
+func TestWaitDirFlag(t *testing.T) {
+	cmd, o := wait.NewCmdWait()
+
+	err := cmd.ParseFlags([]string{"--dir", "my-cluster"})
+	require.NoError(t, err, "failed to parse flags")
+	assert.Equal(t, "my-cluster", o.Dir, "dir")
+}
@@ -2,6 +2,7 @@ package extsecrets
 
 import (
 	"context"
+	"time"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/knative_pkg/duck"
 
@@ -11,6 +12,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
 )
 
 // Client an implementation of the interface
@@ -49,6 +52,11 @@ func (c *client) List(ns string) ([]*v1.ExternalSecret, error) {
 	return answer, nil
 }
 
+// NewInformer creates an informer of the ExternalSecret resources
+func (c *client) NewInformer(ns string, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, ExternalSecretsResource, ns, resyncPeriod, cache.Indexers{}, nil).Informer()
+}
+
 // FromUnstructured converts from an unstructured object to a pointer to a structured type
 func FromUnstructured(u *unstructured.Unstructured, structured interface{}) error {
 	if err := duck.FromUnstructured(u, structured); err != nil {
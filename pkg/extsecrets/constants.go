@@ -4,9 +4,22 @@ const (
 	// SchemaObjectAnnotation the annotation which contains the JSON encoded schema object definition
 	SchemaObjectAnnotation = "secret.jenkins-x.io/schema-object"
 
-	// ReplicateToAnnotation the annotation which lists the namespaces to replicate a Secret to when using local secrets
+	// ReplicateToAnnotation the annotation on a source ExternalSecret which lists the namespaces it is replicated to.
+	// When using local secrets the Secret is also replicated to these namespaces
 	ReplicateToAnnotation = "secret.jenkins-x.io/replicate-to"
 
 	// ReplicaAnnotation the annotation on an ExternalSecret which is a replica
 	ReplicaAnnotation = "secret.jenkins-x.io/replica"
+
+	// ReplicaSourceAnnotation the annotation on a replica ExternalSecret which references the namespace and name of the source ExternalSecret
+	ReplicaSourceAnnotation = "secret.jenkins-x.io/replica-source"
+
+	// CopySourceAnnotation the annotation on a copied Secret which references the namespace and name of the source Secret
+	CopySourceAnnotation = "secret.jenkins-x.io/copy-source"
+
+	// DefaultFieldManager the default field manager used when applying Secrets
+	DefaultFieldManager = "jx-secret"
+
+	// StatusSuccess the status reported by the ExternalSecret controller when the Secret has been synchronised
+	StatusSuccess = "SUCCESS"
 )
@@ -1,14 +1,11 @@
 package factory
 
 import (
-	"os"
-
 	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/cmd/populate"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
-	"github.com/jenkins-x-plugins/jx-secret/pkg/vaults/vaultcli"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/factory"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/kubernetessecrets"
@@ -28,18 +25,6 @@ func NewEditor(secret *v1.ExternalSecret, secretStoreManagerFactory secretstore.
 		secretStoreManagerFactory = &factory.SecretManagerFactory{}
 	}
 	storeType := populate.GetSecretStore(v1alpha1.BackendType(secret.Spec.BackendType))
-	if storeType == secretstore.SecretStoreTypeVault && externalVault != "true" {
-		envMap, err := vaultcli.CreateVaultEnv(kubeClient)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error creating vault env vars")
-		}
-		for k, v := range envMap {
-			err := os.Setenv(k, v)
-			if err != nil {
-				return nil, errors.Wrapf(err, "failed setting env var %s for vault auth", k)
-			}
-		}
-	}
 
 	var secretManager secretstore.Interface
 	// lets use the local kube client if available for better fake testing
@@ -47,7 +32,7 @@ func NewEditor(secret *v1.ExternalSecret, secretStoreManagerFactory secretstore.
 		secretManager = kubernetessecrets.NewKubernetesSecretManager(kubeClient)
 	} else {
 		var err error
-		secretManager, err = secretStoreManagerFactory.NewSecretManager(storeType)
+		secretManager, err = populate.NewSecretManager(secretStoreManagerFactory, kubeClient, secret.Spec.BackendType, externalVault)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error creating secret manager")
 		}
@@ -55,10 +40,15 @@ func NewEditor(secret *v1.ExternalSecret, secretStoreManagerFactory secretstore.
 	return &secretFacadeEditor{secret: secret, secretManager: secretManager}, nil
 }
 
+// Write writes the properties merging them with the current properties of the key.
+// For vault all the current properties are kept using check-and-set. For other stores only the
+// properties of this ExternalSecret which use the key are read back and kept
 func (s *secretFacadeEditor) Write(keyProperties *editor.KeyProperties) error {
-	annotations := s.secret.Spec.Template.Metadata.Annotations
-
-	key := populate.GetSecretKey(v1alpha1.BackendType(s.secret.Spec.BackendType), s.secret.Name, keyProperties.Key)
+	backendType := v1alpha1.BackendType(s.secret.Spec.BackendType)
+	annotations := map[string]string{}
+	for k, v := range s.secret.Spec.Template.Metadata.Annotations {
+		annotations[k] = v
+	}
 
 	// handle replicate to annotation for local secrets so that we also copy the secret to other namespaces
 	replicateTo := ""
@@ -68,11 +58,36 @@ func (s *secretFacadeEditor) Write(keyProperties *editor.KeyProperties) error {
 	if replicateTo != "" {
 		annotations[extsecrets.ReplicateToAnnotation] = replicateTo
 	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
 
 	labels := s.secret.Spec.Template.Metadata.Labels
 	secretType := corev1.SecretType(s.secret.Spec.Template.Type)
-	sv := populate.CreateSecretValue(v1alpha1.BackendType(s.secret.Spec.BackendType), keyProperties.Properties, annotations, labels, secretType)
-	err := s.secretManager.SetSecret(populate.GetExternalSecretLocation(s.secret), populate.GetSecretKey(v1alpha1.BackendType(s.secret.Spec.BackendType), s.secret.Name, key), &sv)
+	key := populate.GetSecretKey(backendType, s.secret.Name, keyProperties.Key)
+
+	// lets read back any other properties of the ExternalSecret which use the same key
+	var properties []string
+	for i := range s.secret.Spec.Data {
+		d := &s.secret.Spec.Data[i]
+		if populate.GetSecretKey(backendType, s.secret.Name, d.Key) != key {
+			continue
+		}
+		pv := editor.PropertyValue{Property: d.Property, Name: d.Name}
+		properties = append(properties, pv.PropertyName())
+	}
+
+	mw := &editor.MergeWrite{
+		Store:      s.secretManager,
+		Location:   populate.GetExternalSecretLocation(s.secret),
+		Key:        key,
+		Properties: properties,
+		Changed:    keyProperties.Properties,
+		CreateSecretValue: func(values []editor.PropertyValue) secretstore.SecretValue {
+			return populate.CreateSecretValue(backendType, values, annotations, labels, secretType)
+		},
+	}
+	err := mw.Write()
 	if err != nil {
 		return errors.Wrapf(err, "failed to save properties %s on ExternalSecret %s", keyProperties.String(), s.secret.Name)
 	}
@@ -22,6 +22,14 @@ type PropertyValue struct {
 	Name     string
 }
 
+// PropertyName returns the name of the property in the secret store defaulting to the entry name
+func (p *PropertyValue) PropertyName() string {
+	if p.Property != "" {
+		return p.Property
+	}
+	return p.Name
+}
+
 // String returns a string representation
 func (p *KeyProperties) String() string {
 	buf := strings.Builder{}
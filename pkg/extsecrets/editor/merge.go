@@ -0,0 +1,140 @@
+package editor
+
+import (
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// MaxWriteAttempts the number of times a merged write is attempted if the secret is modified concurrently
+const MaxWriteAttempts = 3
+
+// ErrVersionConflict is returned when a secret was modified after it was read
+var ErrVersionConflict = errors.New("the secret was modified since it was read")
+
+// ErrVersionsNotSupported is returned by a VersionedStore when the secret does not support versions such as
+// a vault KV version 1 secrets engine so that the properties are merged without optimistic concurrency
+var ErrVersionsNotSupported = errors.New("the secret does not support versions")
+
+// VersionedStore is optionally implemented by secret stores which support optimistic concurrency
+type VersionedStore interface {
+	// GetSecretVersion returns all the properties of the secret and its version which is blank if the secret does not exist
+	GetSecretVersion(location, secretName string) (map[string]string, string, error)
+
+	// SetSecretVersion writes the secret if it is still at the given version otherwise returns ErrVersionConflict
+	SetSecretVersion(location, secretName string, secretValue *secretstore.SecretValue, version string) error
+}
+
+// MergeWrite writes the changed properties of a key by reading the current properties first so that
+// writing some properties does not remove the others as back ends like vault replace all the properties on each write.
+//
+// Stores implementing VersionedStore retry the write if the secret is modified concurrently. Other stores and secrets
+// which do not support versions have no way to detect concurrent writes so the last writer wins
+type MergeWrite struct {
+	Store    secretstore.Interface
+	Location string
+	Key      string
+
+	// Properties the names of the properties of the key which are read and written back if they are not changed.
+	// Stores implementing VersionedStore return all of their properties so this is only used for other stores
+	// which lose any properties written by other tools that are not listed here
+	Properties []string
+
+	// Changed the property values to write
+	Changed []PropertyValue
+
+	// CreateSecretValue creates the secret value to write from the merged property values
+	CreateSecretValue func(values []PropertyValue) secretstore.SecretValue
+}
+
+// Write reads the current properties, merges the changed properties and writes them retrying if the secret is modified concurrently
+func (m *MergeWrite) Write() error {
+	// a secret with a single value rather than properties has nothing to merge
+	if len(m.Changed) == 1 && m.Changed[0].Value != "" {
+		sv := m.CreateSecretValue(m.Changed)
+		if len(sv.PropertyValues) == 0 {
+			return m.Store.SetSecret(m.Location, m.Key, &sv)
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err := m.write()
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrVersionConflict) || attempt >= MaxWriteAttempts {
+			return errors.Wrapf(err, "failed to write key %s after %d attempts", m.Key, attempt)
+		}
+		log.Logger().Debugf("key %s was modified while it was being written so retrying", m.Key)
+	}
+}
+
+func (m *MergeWrite) write() error {
+	vs, ok := m.Store.(VersionedStore)
+	if ok {
+		current, version, err := vs.GetSecretVersion(m.Location, m.Key)
+		if err == nil {
+			sv := m.CreateSecretValue(m.merge(current))
+			return vs.SetSecretVersion(m.Location, m.Key, &sv, version)
+		}
+		if !errors.Is(err, ErrVersionsNotSupported) {
+			return errors.Wrapf(err, "failed to read key %s", m.Key)
+		}
+		log.Logger().Debugf("key %s does not support versions so merging its properties without check-and-set", m.Key)
+	}
+
+	current, err := m.read()
+	if err != nil {
+		return err
+	}
+	sv := m.CreateSecretValue(m.merge(current))
+	return m.Store.SetSecret(m.Location, m.Key, &sv)
+}
+
+// read reads the properties which are not changed failing if a property cannot be read for any reason other than it not existing
+func (m *MergeWrite) read() (map[string]string, error) {
+	answer := map[string]string{}
+	for _, name := range m.Properties {
+		if name == "" || m.changed(name) {
+			continue
+		}
+		value, err := m.Store.GetSecret(m.Location, m.Key, name)
+		if err != nil {
+			if !IsSecretNotFound(err) {
+				return nil, errors.Wrapf(err, "failed to read property %s of key %s", name, m.Key)
+			}
+			log.Logger().Debugf("property %s of key %s does not exist: %s", name, m.Key, err.Error())
+			continue
+		}
+		if value != "" {
+			answer[name] = value
+		}
+	}
+	return answer, nil
+}
+
+// merge returns the changed property values with the current values of the other properties.
+// Blank changed values such as optional or not yet synchronised properties never replace the current values
+func (m *MergeWrite) merge(current map[string]string) []PropertyValue {
+	var answer []PropertyValue
+	for i := range m.Changed {
+		if m.Changed[i].Value != "" {
+			answer = append(answer, m.Changed[i])
+		}
+	}
+	for k, v := range current {
+		if v != "" && !m.changed(k) {
+			answer = append(answer, PropertyValue{Property: k, Value: v})
+		}
+	}
+	SortPropertyValues(answer)
+	return answer
+}
+
+func (m *MergeWrite) changed(name string) bool {
+	for i := range m.Changed {
+		if m.Changed[i].Value != "" && m.Changed[i].PropertyName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package editor_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	secretstorefake "github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	location = "https://127.0.0.1:8200"
+	key      = "secret/data/jx/adminUser"
+)
+
+func TestMergeWriteKeepsOtherProperties(t *testing.T) {
+	store := newFakeStore(t, map[string]string{"username": "admin", "password": "old"})
+
+	mw := newMergeWrite(store, []string{"username", "password"}, editor.PropertyValue{Property: "password", Value: "new"})
+	err := mw.Write()
+	require.NoError(t, err, "failed to write")
+
+	store.AssertValueEquals(t, location, key, "username", "admin")
+	store.AssertValueEquals(t, location, key, "password", "new")
+}
+
+func TestMergeWriteKeepsCurrentValueOfBlankProperty(t *testing.T) {
+	store := newFakeStore(t, map[string]string{"a": "existing"})
+
+	mw := newMergeWrite(store, []string{"a", "b"}, editor.PropertyValue{Property: "a"}, editor.PropertyValue{Property: "b", Value: "new"})
+	err := mw.Write()
+	require.NoError(t, err, "failed to write")
+
+	store.AssertValueEquals(t, location, key, "a", "existing")
+	store.AssertValueEquals(t, location, key, "b", "new")
+
+	versioned := &versionedStore{properties: map[string]string{"a": "existing"}}
+	mw = newMergeWrite(versioned, nil, editor.PropertyValue{Property: "a"}, editor.PropertyValue{Property: "b", Value: "new"})
+	err = mw.Write()
+	require.NoError(t, err, "failed to write versioned store")
+	assert.Equal(t, map[string]string{"a": "existing", "b": "new"}, versioned.properties, "properties")
+}
+
+func TestMergeWriteReadErrors(t *testing.T) {
+	store := newFakeStore(t, map[string]string{"username": "admin", "password": "old"})
+
+	// a property which does not exist yet is not an error
+	mw := newMergeWrite(store, []string{"username", "password", "token"}, editor.PropertyValue{Property: "password", Value: "new"})
+	err := mw.Write()
+	require.NoError(t, err, "failed to write with a missing property")
+	store.AssertValueEquals(t, location, key, "username", "admin")
+	store.AssertValueEquals(t, location, key, "password", "new")
+
+	failing := &failingStore{SecretStore: store, err: errors.New("permission denied")}
+	mw = newMergeWrite(failing, []string{"username", "password"}, editor.PropertyValue{Property: "password", Value: "newer"})
+	err = mw.Write()
+	require.Error(t, err, "should fail if a property cannot be read")
+	assert.Contains(t, err.Error(), "permission denied", "error")
+
+	// the other properties are not lost
+	store.AssertValueEquals(t, location, key, "username", "admin")
+	store.AssertValueEquals(t, location, key, "password", "new")
+}
+
+func TestMergeWriteVersionedStore(t *testing.T) {
+	store := &versionedStore{
+		properties: map[string]string{"username": "admin", "password": "old", "token": "written-by-another-tool"},
+		conflicts:  1,
+	}
+
+	// the versioned store returns all the properties so we don't need to know them
+	mw := newMergeWrite(store, nil, editor.PropertyValue{Property: "password", Value: "new"})
+	err := mw.Write()
+	require.NoError(t, err, "failed to write")
+
+	assert.Equal(t, map[string]string{"username": "admin", "password": "new", "token": "written-by-another-tool"}, store.properties, "properties")
+	assert.Equal(t, 2, store.version, "version")
+}
+
+func newFakeStore(t *testing.T, properties map[string]string) *secretstorefake.SecretStore {
+	factory := &secretstorefake.SecretManagerFactory{}
+	_, err := factory.NewSecretManager(secretstore.SecretStoreTypeVault)
+	require.NoError(t, err, "failed to create fake secret store")
+	store := factory.GetSecretStore()
+	err = store.SetSecret(location, key, &secretstore.SecretValue{PropertyValues: properties})
+	require.NoError(t, err, "failed to set secret")
+	return store
+}
+
+func newMergeWrite(store secretstore.Interface, properties []string, changed ...editor.PropertyValue) *editor.MergeWrite {
+	return &editor.MergeWrite{
+		Store:      store,
+		Location:   location,
+		Key:        key,
+		Properties: properties,
+		Changed:    changed,
+		CreateSecretValue: func(values []editor.PropertyValue) secretstore.SecretValue {
+			m := map[string]string{}
+			for i := range values {
+				m[values[i].PropertyName()] = values[i].Value
+			}
+			return secretstore.SecretValue{PropertyValues: m}
+		},
+	}
+}
+
+// failingStore fails to read any property with the given error
+type failingStore struct {
+	*secretstorefake.SecretStore
+	err error
+}
+
+func (s *failingStore) GetSecret(_, _, _ string) (string, error) {
+	return "", s.err
+}
+
+// versionedStore a store which supports optimistic concurrency which fails the given number of writes
+type versionedStore struct {
+	properties map[string]string
+	version    int
+	conflicts  int
+}
+
+func (s *versionedStore) GetSecret(_, _, secretKey string) (string, error) {
+	return s.properties[secretKey], nil
+}
+
+func (s *versionedStore) SetSecret(_, _ string, secretValue *secretstore.SecretValue) error {
+	s.properties = secretValue.PropertyValues
+	s.version++
+	return nil
+}
+
+func (s *versionedStore) GetSecretVersion(_, _ string) (map[string]string, string, error) {
+	properties := map[string]string{}
+	for k, v := range s.properties {
+		properties[k] = v
+	}
+	return properties, fmt.Sprintf("%d", s.version), nil
+}
+
+func (s *versionedStore) SetSecretVersion(location, secretName string, secretValue *secretstore.SecretValue, version string) error {
+	if s.conflicts > 0 {
+		// lets simulate another tool writing the secret
+		s.conflicts--
+		s.version++
+	}
+	if version != fmt.Sprintf("%d", s.version) {
+		return editor.ErrVersionConflict
+	}
+	return s.SetSecret(location, secretName, secretValue)
+}
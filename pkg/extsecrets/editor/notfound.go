@@ -0,0 +1,61 @@
+package editor
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// notFoundMessages the exact text of the errors without a cause which the secret stores return for missing
+// secrets and properties
+var notFoundMessages = []*regexp.Regexp{
+	// vault when the secret does not exist
+	regexp.MustCompile(`^error getting secret \S+ from Hasicorp vault \S+: %!w\(<nil>\)$`),
+	// vault when the property does not exist in the secret
+	regexp.MustCompile(`^\S+ does not occur in secret data$`),
+	// kubernetes when the property does not exist in the secret
+	regexp.MustCompile(`^failed to get secret \S+ from namespace \S+$`),
+	// the fake secret store used in tests
+	regexp.MustCompile(`^unable to find key \S* in secret \S+$`),
+}
+
+// IsSecretNotFound returns true if the error returned by GetSecret means the secret or its property does not exist
+// rather than the secret store failing
+func IsSecretNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsNotFound(err) || status.Code(err) == codes.NotFound {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException || awsErr.Code() == ssm.ErrCodeParameterNotFound
+	}
+	var azureErr *azcore.ResponseError
+	if errors.As(err, &azureErr) {
+		return azureErr.StatusCode == http.StatusNotFound
+	}
+
+	// the vault, kubernetes and fake secret stores only report missing secrets and properties with the text
+	// of an error that has no cause so match the exact text of the root error
+	root := err
+	for cause := errors.Unwrap(root); cause != nil; cause = errors.Unwrap(root) {
+		root = cause
+	}
+	text := root.Error()
+	for _, r := range notFoundMessages {
+		if r.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
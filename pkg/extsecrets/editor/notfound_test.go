@@ -0,0 +1,47 @@
+package editor_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestIsSecretNotFound(t *testing.T) {
+	var nilErr error
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "kubernetes", err: fmt.Errorf("failed to get secret jx-basic-auth from namespace jx: %w", apierrors.NewNotFound(corev1.Resource("secrets"), "jx-basic-auth")), expected: true},
+		{name: "kubernetes property", err: fmt.Errorf("failed to get secret jx-basic-auth from namespace jx"), expected: true},
+		{name: "kubernetes forbidden", err: fmt.Errorf("failed to get secret jx-basic-auth from namespace jx: %w", apierrors.NewForbidden(corev1.Resource("secrets"), "jx-basic-auth", errors.New("denied"))), expected: false},
+		{name: "gcp", err: fmt.Errorf("error getting secret jx-basic-auth: %w", status.Error(codes.NotFound, "not found")), expected: true},
+		{name: "gcp permission", err: fmt.Errorf("error getting secret jx-basic-auth: %w", status.Error(codes.PermissionDenied, "denied")), expected: false},
+		{name: "aws", err: fmt.Errorf("error retrieving existing secret: %w", awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)), expected: true},
+		{name: "aws throttled", err: fmt.Errorf("error retrieving existing secret: %w", awserr.New("ThrottlingException", "slow down", nil)), expected: false},
+		{name: "vault", err: fmt.Errorf("error getting secret secret/data/jx-basic-auth from Hasicorp vault https://vault: %w", nilErr), expected: true},
+		{name: "vault property", err: fmt.Errorf("error converting string data: %w", errors.New("password does not occur in secret data")), expected: true},
+		{name: "vault network", err: fmt.Errorf("error getting secret secret/data/jx-basic-auth from Hasicorp vault https://vault: %w", errors.New("connection refused")), expected: false},
+		{name: "fake", err: fmt.Errorf("unable to find key password in secret jx-basic-auth"), expected: true},
+		{name: "vault wrapped", err: pkgerrors.Wrap(fmt.Errorf("error getting secret secret/data/jx-basic-auth from Hasicorp vault https://vault: %w", nilErr), "failed to get key"), expected: true},
+		{name: "vault permission denied", err: errors.New("error getting secret secret/data/jx-basic-auth: permission denied"), expected: false},
+		{name: "kubernetes permission denied", err: errors.New("failed to get secret jx-basic-auth from namespace jx: forbidden"), expected: false},
+		{name: "fake permission denied", err: errors.New("unable to find key password in secret jx-basic-auth: permission denied"), expected: false},
+		{name: "other", err: errors.New("permission denied"), expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, editor.IsSecretNotFound(tc.err), tc.name)
+	}
+}
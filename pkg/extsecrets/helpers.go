@@ -14,8 +14,10 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 )
 
 var (
@@ -48,8 +50,38 @@ func SimplifyKey(backendType, key string) string {
 	return key
 }
 
+// CopyOptions the options for copying a Secret to a namespace
+type CopyOptions struct {
+	// Mirror removes any data entries from the copy which are not in the source
+	Mirror bool
+	// ServerSideApply uses server side apply so that only the fields owned by the FieldManager are changed
+	ServerSideApply bool
+	// FieldManager the field manager used for server side apply which defaults to DefaultFieldManager
+	FieldManager string
+	// ForceConflicts takes ownership of fields owned by other field managers when using server side apply
+	// rather than failing with a conflict
+	ForceConflicts bool
+}
+
 // CopySecretToNamespace copies the given secret to the namespace
 func CopySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret) error {
+	return CopySecretToNamespaceWithOptions(kubeClient, ns, fromSecret, CopyOptions{})
+}
+
+// CopySecretToNamespaceWithOptions copies the given secret to the namespace retrying if there are conflicting updates
+func CopySecretToNamespaceWithOptions(kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret, copyOptions CopyOptions) error {
+	if copyOptions.ServerSideApply {
+		return applySecretToNamespace(kubeClient, ns, fromSecret, copyOptions)
+	}
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	return retry.OnError(retry.DefaultRetry, retriable, func() error {
+		return copySecretToNamespace(kubeClient, ns, fromSecret, copyOptions)
+	})
+}
+
+func copySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret, copyOptions CopyOptions) error {
 	secretInterface := kubeClient.CoreV1().Secrets(ns)
 	name := fromSecret.Name
 	secret, err := secretInterface.Get(context.TODO(), name, metav1.GetOptions{})
@@ -57,7 +89,7 @@ func CopySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecre
 	create := false
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return errors.Wrapf(err, "failed to ")
+			return errors.Wrapf(err, "failed to get Secret %s in namespace %s", name, ns)
 		}
 		create = true
 		secret = &corev1.Secret{
@@ -88,6 +120,9 @@ func CopySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecre
 			secret.Labels[k] = v
 		}
 	}
+	if copyOptions.Mirror {
+		secret.Data = map[string][]byte{}
+	}
 	if fromSecret.Data != nil {
 		if secret.Data == nil {
 			secret.Data = map[string][]byte{}
@@ -113,6 +148,37 @@ func CopySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecre
 	return nil
 }
 
+// applySecretToNamespace uses server side apply to copy the secret so that fields owned by other field managers are retained.
+// Any data entries previously applied by the field manager which are no longer in the source are removed.
+//
+// If a field is owned by another field manager the apply fails unless ForceConflicts is enabled
+func applySecretToNamespace(kubeClient kubernetes.Interface, ns string, fromSecret *corev1.Secret, copyOptions CopyOptions) error {
+	name := fromSecret.Name
+	fieldManager := copyOptions.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	secret := corev1apply.Secret(name, ns).
+		WithLabels(fromSecret.Labels).
+		WithAnnotations(fromSecret.Annotations).
+		WithData(fromSecret.Data)
+	if string(fromSecret.Type) != "" {
+		secret = secret.WithType(fromSecret.Type)
+	}
+	_, err := kubeClient.CoreV1().Secrets(ns).Apply(context.TODO(), secret, metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		Force:        copyOptions.ForceConflicts,
+	})
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			return errors.Wrapf(err, "failed to apply Secret %s in namespace %s as fields are owned by another field manager. Use --force-conflicts to take ownership of them", name, ns)
+		}
+		return errors.Wrapf(err, "failed to apply Secret %s in namespace %s", name, ns)
+	}
+	log.Logger().Infof("applied Secret %s in namespace %s", info(name), info(ns))
+	return nil
+}
+
 // DefaultHelmSecretFolder creates a default helm secret folder
 func DefaultHelmSecretFolder() string {
 	answer := os.Getenv("JX_HELM_SECRET_FOLDER")
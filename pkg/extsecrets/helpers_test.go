@@ -1,6 +1,8 @@
 package extsecrets
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
 	"testing"
 
@@ -8,6 +10,12 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/yamls"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
 )
 
 func TestUnmarshalSuccess(t *testing.T) {
@@ -71,3 +79,103 @@ func TestUnmarshalFailure(t *testing.T) {
 	require.NotNil(t, es.Status, "es.Status")
 	assert.Equal(t, "ERROR, Status 404", es.Status.Status, "es.Status.Status")
 }
+
+func TestCopySecretToNamespaceMirrorRetriesOnConflict(t *testing.T) {
+	ctx := context.TODO()
+	ns := "jx-preview"
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-secret",
+				Namespace: ns,
+			},
+			Data: map[string][]byte{
+				"password": []byte("old"),
+				"stale":    []byte("stale"),
+			},
+		},
+	)
+
+	conflicts := 0
+	kubeClient.PrependReactor("update", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(corev1.Resource("secrets"), "my-secret", errors.New("modified"))
+	})
+
+	fromSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-secret",
+			Namespace: "jx",
+		},
+		Data: map[string][]byte{
+			"password": []byte("new"),
+		},
+	}
+	err := CopySecretToNamespaceWithOptions(kubeClient, ns, fromSecret, CopyOptions{Mirror: true})
+	require.NoError(t, err, "failed to copy secret")
+	assert.Equal(t, 1, conflicts, "should have had a conflict")
+
+	secret, err := kubeClient.CoreV1().Secrets(ns).Get(ctx, "my-secret", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get secret")
+	assert.Equal(t, map[string][]byte{"password": []byte("new")}, secret.Data, "should have mirrored the data")
+}
+
+func TestCopySecretToNamespaceServerSideApply(t *testing.T) {
+	ctx := context.TODO()
+	ns := "jx-preview"
+	kubeClient := fake.NewClientset()
+
+	fromSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-secret",
+			Namespace: "jx",
+			Labels:    map[string]string{"app": "cheese"},
+		},
+		Data: map[string][]byte{
+			"password": []byte("new"),
+		},
+	}
+	err := CopySecretToNamespaceWithOptions(kubeClient, ns, fromSecret, CopyOptions{ServerSideApply: true})
+	require.NoError(t, err, "failed to apply secret")
+
+	secret, err := kubeClient.CoreV1().Secrets(ns).Get(ctx, "my-secret", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get secret")
+	assert.Equal(t, "new", string(secret.Data["password"]), "password")
+	assert.Equal(t, "cheese", secret.Labels["app"], "label")
+}
+
+func TestCopySecretToNamespaceServerSideApplyConflict(t *testing.T) {
+	ns := "jx-preview"
+	kubeClient := fake.NewClientset()
+
+	var forced []bool
+	kubeClient.PrependReactor("patch", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		opts := action.(clienttesting.PatchActionImpl).GetPatchOptions()
+		force := opts.Force != nil && *opts.Force
+		forced = append(forced, force)
+		if !force {
+			return true, nil, apierrors.NewConflict(corev1.Resource("secrets"), "my-secret", errors.New("conflict with \"other-controller\""))
+		}
+		return false, nil, nil
+	})
+
+	fromSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-secret",
+			Namespace: "jx",
+		},
+		Data: map[string][]byte{
+			"password": []byte("new"),
+		},
+	}
+	err := CopySecretToNamespaceWithOptions(kubeClient, ns, fromSecret, CopyOptions{ServerSideApply: true})
+	require.Error(t, err, "should fail when fields are owned by another field manager")
+	assert.Contains(t, err.Error(), "--force-conflicts", "error message")
+
+	err = CopySecretToNamespaceWithOptions(kubeClient, ns, fromSecret, CopyOptions{ServerSideApply: true, ForceConflicts: true})
+	require.NoError(t, err, "failed to apply secret with force conflicts")
+	assert.Equal(t, []bool{false, true}, forced, "apply force options")
+}
@@ -1,9 +1,19 @@
 package extsecrets
 
 import (
+	"time"
+
 	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 type Interface interface {
 	List(ns string) ([]*v1.ExternalSecret, error)
 }
+
+// InformerFactory is implemented by clients which can watch the ExternalSecret resources
+type InformerFactory interface {
+	// NewInformer creates an informer of the ExternalSecret resources in the namespace or all namespaces if it is blank.
+	// The informer store contains unstructured objects which can be converted via FromUnstructured
+	NewInformer(ns string, resyncPeriod time.Duration) cache.SharedIndexInformer
+}
@@ -0,0 +1,181 @@
+package secretfacade
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SecretFilter filters the ExternalSecrets used by a command.
+//
+// An ExternalSecret matches if it matches all of the specified filters
+type SecretFilter struct {
+	// Selector the label selector of the ExternalSecrets
+	Selector string
+
+	// Names the names or name globs of the ExternalSecrets
+	Names []string
+
+	// NameRegex the regular expression of the names of the ExternalSecrets
+	NameRegex string
+
+	// Namespaces the namespaces or namespace globs of the ExternalSecrets
+	Namespaces []string
+
+	// BackendTypes the backend types of the ExternalSecrets such as gcpSecretsManager or vault
+	BackendTypes []string
+
+	// SchemaObjects the names or name globs of the schema objects of the ExternalSecrets
+	SchemaObjects []string
+
+	// SchemaLabel the label selector of any of the schema properties of the ExternalSecrets
+	SchemaLabel string
+
+	// Mandatory only matches ExternalSecrets with a mandatory schema object
+	Mandatory bool
+
+	parsed         bool
+	selector       labels.Selector
+	nameRegex      *regexp.Regexp
+	schemaSelector labels.Selector
+}
+
+// AddFlags adds the CLI flags for the filter.
+//
+// The namespace globs use --namespace-glob as commands already use --ns or --namespace for the namespace to load the ExternalSecrets from
+func (f *SecretFilter) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.Selector, "selector", "l", "", "the label selector of the ExternalSecrets")
+	cmd.Flags().StringArrayVarP(&f.Names, "name", "", nil, "the names or name globs of the ExternalSecrets")
+	cmd.Flags().StringVarP(&f.NameRegex, "name-regex", "", "", "the regular expression of the names of the ExternalSecrets")
+	cmd.Flags().StringArrayVarP(&f.Namespaces, "namespace-glob", "", nil, "the namespaces or namespace globs of the ExternalSecrets")
+	cmd.Flags().StringArrayVarP(&f.BackendTypes, "backend-type", "", nil, "the backend types of the ExternalSecrets such as gcpSecretsManager or vault")
+	cmd.Flags().StringArrayVarP(&f.SchemaObjects, "schema-object", "", nil, "the names or name globs of the schema objects of the ExternalSecrets")
+	cmd.Flags().StringVarP(&f.SchemaLabel, "schema-label", "", "", "the label selector of the schema properties of the ExternalSecrets")
+	cmd.Flags().BoolVarP(&f.Mandatory, "mandatory", "", false, "only the ExternalSecrets which are mandatory in their schema")
+}
+
+// IsEmpty returns true if no filters are specified
+func (f *SecretFilter) IsEmpty() bool {
+	return f.Selector == "" && len(f.Names) == 0 && f.NameRegex == "" && len(f.Namespaces) == 0 &&
+		len(f.BackendTypes) == 0 && len(f.SchemaObjects) == 0 && f.SchemaLabel == "" && !f.Mandatory
+}
+
+// Validate parses the selectors and regular expression and validates the globs
+func (f *SecretFilter) Validate() error {
+	if f.parsed {
+		return nil
+	}
+	var err error
+	if f.Selector != "" {
+		f.selector, err = labels.Parse(f.Selector)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse selector %s", f.Selector)
+		}
+	}
+	if f.NameRegex != "" {
+		f.nameRegex, err = regexp.Compile(f.NameRegex)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse name regex %s", f.NameRegex)
+		}
+	}
+	if f.SchemaLabel != "" {
+		f.schemaSelector, err = labels.Parse(f.SchemaLabel)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse schema label selector %s", f.SchemaLabel)
+		}
+	}
+	var globs []string
+	globs = append(globs, f.Names...)
+	globs = append(globs, f.Namespaces...)
+	globs = append(globs, f.SchemaObjects...)
+	for _, glob := range globs {
+		_, err = filepath.Match(glob, "")
+		if err != nil {
+			return errors.Wrapf(err, "invalid glob %s", glob)
+		}
+	}
+	f.parsed = true
+	return nil
+}
+
+// Matches returns true if the secret matches all of the filters
+func (f *SecretFilter) Matches(p *SecretPair) bool {
+	err := f.Validate()
+	if err != nil {
+		log.Logger().Warnf("%s", err.Error())
+		return false
+	}
+	es := &p.ExternalSecret
+	if f.selector != nil && !f.selector.Matches(labels.Set(es.Labels)) {
+		return false
+	}
+	if len(f.Names) > 0 && !MatchesAnyGlob(f.Names, es.Name) {
+		return false
+	}
+	if f.nameRegex != nil && !f.nameRegex.MatchString(es.Name) {
+		return false
+	}
+	if len(f.Namespaces) > 0 && !MatchesAnyGlob(f.Namespaces, es.Namespace) {
+		return false
+	}
+	if len(f.BackendTypes) > 0 && stringhelpers.StringArrayIndex(f.BackendTypes, es.Spec.BackendType) < 0 {
+		return false
+	}
+	if len(f.SchemaObjects) == 0 && f.schemaSelector == nil && !f.Mandatory {
+		return true
+	}
+
+	obj, err := p.SchemaObject()
+	if err != nil {
+		log.Logger().Warnf("%s", err.Error())
+		return false
+	}
+	if obj == nil {
+		return false
+	}
+	if f.Mandatory && !obj.Mandatory {
+		return false
+	}
+	if len(f.SchemaObjects) > 0 && !MatchesAnyGlob(f.SchemaObjects, obj.Name) {
+		return false
+	}
+	if f.schemaSelector != nil {
+		for i := range obj.Properties {
+			if f.schemaSelector.Matches(labels.Set(obj.Properties[i].Labels)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// HasFilters returns true if the name filter or any of the secret filters are specified
+func (o *Options) HasFilters() bool {
+	return o.Filter != "" || !o.SecretFilter.IsEmpty()
+}
+
+// Matches returns true if the secret name contains the name filter and matches the secret filters
+func (o *Options) Matches(p *SecretPair) bool {
+	if o.Filter != "" && !strings.Contains(p.Name(), o.Filter) {
+		return false
+	}
+	return o.SecretFilter.Matches(p)
+}
+
+// MatchesAnyGlob returns true if the text matches any of the globs
+func MatchesAnyGlob(globs []string, text string) bool {
+	for _, glob := range globs {
+		matched, err := filepath.Match(glob, text)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package secretfacade_test
+
+import (
+	"testing"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	schema "github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSecretFilter(t *testing.T) {
+	newPair := func(ns, name, backendType string, labels map[string]string, obj *schema.Object) *secretfacade.SecretPair {
+		p := &secretfacade.SecretPair{
+			ExternalSecret: v1.ExternalSecret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: ns,
+					Labels:    labels,
+				},
+				Spec: v1.ExternalSecretSpec{
+					BackendType: backendType,
+				},
+			},
+		}
+		if obj != nil {
+			p.SetSchemaObject(obj)
+		}
+		return p
+	}
+
+	pairs := []*secretfacade.SecretPair{
+		newPair("jx", "lighthouse-oauth-token", "gcpSecretsManager", map[string]string{"app": "lighthouse"}, &schema.Object{
+			Name:      "lighthouse-oauth-token",
+			Mandatory: true,
+			Properties: []schema.Property{
+				{Name: "oauth", Labels: map[string]string{"kind": "git"}},
+			},
+		}),
+		newPair("jx", "lighthouse-hmac-token", "vault", map[string]string{"app": "lighthouse"}, &schema.Object{
+			Name: "lighthouse-hmac-token",
+			Properties: []schema.Property{
+				{Name: "hmac"},
+			},
+		}),
+		newPair("tekton-pipelines", "tekton-git", "gcpSecretsManager", map[string]string{"app": "tekton"}, nil),
+	}
+
+	testCases := []struct {
+		name     string
+		filter   secretfacade.SecretFilter
+		expected []string
+	}{
+		{
+			name:     "empty",
+			expected: []string{"lighthouse-oauth-token", "lighthouse-hmac-token", "tekton-git"},
+		},
+		{
+			name:     "selector",
+			filter:   secretfacade.SecretFilter{Selector: "app=lighthouse"},
+			expected: []string{"lighthouse-oauth-token", "lighthouse-hmac-token"},
+		},
+		{
+			name:     "name glob",
+			filter:   secretfacade.SecretFilter{Names: []string{"*-git", "lighthouse-hmac-*"}},
+			expected: []string{"lighthouse-hmac-token", "tekton-git"},
+		},
+		{
+			name:     "name regex",
+			filter:   secretfacade.SecretFilter{NameRegex: "^lighthouse-(oauth|hmac)"},
+			expected: []string{"lighthouse-oauth-token", "lighthouse-hmac-token"},
+		},
+		{
+			name:     "namespace",
+			filter:   secretfacade.SecretFilter{Namespaces: []string{"tekton-*"}},
+			expected: []string{"tekton-git"},
+		},
+		{
+			name:     "backend type",
+			filter:   secretfacade.SecretFilter{BackendTypes: []string{"gcpSecretsManager"}},
+			expected: []string{"lighthouse-oauth-token", "tekton-git"},
+		},
+		{
+			name:     "schema object",
+			filter:   secretfacade.SecretFilter{SchemaObjects: []string{"lighthouse-*"}},
+			expected: []string{"lighthouse-oauth-token", "lighthouse-hmac-token"},
+		},
+		{
+			name:     "schema label",
+			filter:   secretfacade.SecretFilter{SchemaLabel: "kind=git"},
+			expected: []string{"lighthouse-oauth-token"},
+		},
+		{
+			name:     "mandatory",
+			filter:   secretfacade.SecretFilter{Mandatory: true},
+			expected: []string{"lighthouse-oauth-token"},
+		},
+		{
+			name:     "selector and backend type",
+			filter:   secretfacade.SecretFilter{Selector: "app=lighthouse", BackendTypes: []string{"vault"}},
+			expected: []string{"lighthouse-hmac-token"},
+		},
+	}
+
+	for _, tc := range testCases {
+		f := tc.filter
+		err := f.Validate()
+		require.NoError(t, err, "failed to validate filter for %s", tc.name)
+
+		var names []string
+		for _, p := range pairs {
+			if f.Matches(p) {
+				names = append(names, p.Name())
+			}
+		}
+		assert.Equal(t, tc.expected, names, "for %s", tc.name)
+	}
+
+	// lets check the name filter is combined with the secret filter
+	o := &secretfacade.Options{
+		Filter: "token",
+		SecretFilter: secretfacade.SecretFilter{
+			BackendTypes: []string{"gcpSecretsManager"},
+		},
+	}
+	assert.True(t, o.HasFilters(), "should have filters")
+	assert.True(t, o.Matches(pairs[0]), "should match %s", pairs[0].Name())
+	assert.False(t, o.Matches(pairs[1]), "should not match %s", pairs[1].Name())
+	assert.False(t, o.Matches(pairs[2]), "should not match %s", pairs[2].Name())
+}
+
+func TestSecretFilterInvalid(t *testing.T) {
+	for _, f := range []secretfacade.SecretFilter{
+		{Selector: "app in (lighthouse"},
+		{NameRegex: "lighthouse-("},
+		{Names: []string{"lighthouse-["}},
+		{SchemaLabel: "kind in (git"},
+	} {
+		err := f.Validate()
+		assert.Error(t, err, "should have failed to validate %#v", f)
+	}
+}
+
+func TestSecretFilterFlags(t *testing.T) {
+	o := &secretfacade.Options{}
+	cmd := &cobra.Command{}
+	o.AddFlags(cmd)
+
+	err := cmd.ParseFlags([]string{"--namespace-glob", "jx-*", "--name", "lighthouse-*", "-l", "app=tekton"})
+	require.NoError(t, err, "failed to parse flags")
+
+	assert.Equal(t, []string{"jx-*"}, o.SecretFilter.Namespaces, "namespace globs")
+	assert.Equal(t, []string{"lighthouse-*"}, o.SecretFilter.Names, "names")
+	assert.Equal(t, "app=tekton", o.SecretFilter.Selector, "selector")
+	assert.True(t, o.HasFilters(), "should have filters")
+}
@@ -2,6 +2,9 @@ package secretfacade
 
 import (
 	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -42,3 +45,65 @@ func VerifySecret(es *v1.ExternalSecret, secret *corev1.Secret) (*SecretError, e
 		EntryErrors:    answer,
 	}, nil
 }
+
+// VerifyValues validates the populated values of the Secret against the properties in the schema
+func VerifyValues(p *SecretPair) ([]*ValueError, error) {
+	if p.Secret == nil || len(p.Secret.Data) == 0 {
+		return nil, nil
+	}
+	obj, err := p.SchemaObject()
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	var answer []*ValueError
+	for _, d := range p.ExternalSecret.Spec.Data {
+		value := p.Secret.Data[d.Name]
+		if len(value) == 0 {
+			continue
+		}
+		messages, err := schemas.ValidatePropertyValue(obj.FindProperty(d.Name), string(value))
+		if err != nil {
+			return answer, errors.Wrapf(err, "failed to validate entry %s", d.Name)
+		}
+		if len(messages) > 0 {
+			answer = append(answer, &ValueError{
+				Name:     d.Name,
+				Messages: messages,
+			})
+		}
+	}
+	return answer, nil
+}
+
+// VerifySyncStatus verifies the status reported by the ExternalSecret controller.
+// Returns nil if the ExternalSecret has no status, such as when it has not been applied to a cluster, or it is synchronised
+func VerifySyncStatus(es *v1.ExternalSecret) *SyncError {
+	status := es.Status
+	if status == nil || status.Status == "" {
+		return nil
+	}
+	failed := status.Status != extsecrets.StatusSuccess
+	stale := es.Generation > 0 && int64(status.ObservedGeneration) < es.Generation
+	if !failed && !stale {
+		return nil
+	}
+	return &SyncError{
+		ExternalSecret: *es,
+		Status:         status.Status,
+		Failed:         failed,
+		Stale:          stale,
+	}
+}
+
+// SyncStatus returns the status reported by the ExternalSecret controller or unknown if there is no status
+func SyncStatus(es *v1.ExternalSecret) string {
+	if es.Status == nil || es.Status.Status == "" {
+		return "unknown"
+	}
+	return es.Status.Status
+}
+
+// IsSynced returns true if the ExternalSecret controller has successfully synchronised the Secret
+func IsSynced(es *v1.ExternalSecret) bool {
+	return es.Status != nil && es.Status.Status == extsecrets.StatusSuccess
+}
@@ -0,0 +1,73 @@
+package secretfacade_test
+
+import (
+	"testing"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerifySyncStatus(t *testing.T) {
+	testCases := []struct {
+		name               string
+		status             *v1.ExternalSecretStatus
+		generation         int64
+		expectFailed       bool
+		expectStale        bool
+		expectNoSyncErrors bool
+	}{
+		{
+			name:               "no status",
+			generation:         1,
+			expectNoSyncErrors: true,
+		},
+		{
+			name:               "synced",
+			status:             &v1.ExternalSecretStatus{Status: "SUCCESS", ObservedGeneration: 2},
+			generation:         2,
+			expectNoSyncErrors: true,
+		},
+		{
+			name:         "failed",
+			status:       &v1.ExternalSecretStatus{Status: "ERROR, Status 404", ObservedGeneration: 2},
+			generation:   2,
+			expectFailed: true,
+		},
+		{
+			name:        "stale",
+			status:      &v1.ExternalSecretStatus{Status: "SUCCESS", ObservedGeneration: 1},
+			generation:  2,
+			expectStale: true,
+		},
+		{
+			name:         "failed and stale",
+			status:       &v1.ExternalSecretStatus{Status: "ERROR", ObservedGeneration: 1},
+			generation:   3,
+			expectFailed: true,
+			expectStale:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		es := &v1.ExternalSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "my-secret",
+				Generation: tc.generation,
+			},
+			Status: tc.status,
+		}
+		result := secretfacade.VerifySyncStatus(es)
+		if tc.expectNoSyncErrors {
+			assert.Nil(t, result, "sync error for %s", tc.name)
+			continue
+		}
+		require.NotNil(t, result, "sync error for %s", tc.name)
+		assert.Equal(t, tc.expectFailed, result.Failed, "failed for %s", tc.name)
+		assert.Equal(t, tc.expectStale, result.Stale, "stale for %s", tc.name)
+		assert.NotEmpty(t, result.Message(), "message for %s", tc.name)
+		t.Logf("%s: %s", tc.name, result.Message())
+	}
+}
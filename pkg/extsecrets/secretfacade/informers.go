@@ -0,0 +1,133 @@
+package secretfacade
+
+import (
+	"sort"
+	"time"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informers caches the ExternalSecret and Secret resources so they can be loaded without querying the API server
+type informers struct {
+	externalSecrets cache.SharedIndexInformer
+	secrets         cache.SharedIndexInformer
+	stop            <-chan struct{}
+}
+
+// StartInformers starts informers on the ExternalSecret and Secret resources until the stop channel is closed.
+// Once the informers have synced Load uses their caches rather than querying the API server.
+//
+// The onChange function is invoked whenever a resource is added, updated or deleted.
+// Returns false if the SecretClient does not support informers such as when using the filesystem
+func (o *Options) StartInformers(stop <-chan struct{}, onChange func()) (bool, error) {
+	factory, ok := o.SecretClient.(extsecrets.InformerFactory)
+	if !ok {
+		return false, nil
+	}
+	var err error
+	o.KubeClient, err = kube.LazyCreateKubeClient(o.KubeClient)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to create kube Client")
+	}
+
+	resyncPeriod := 10 * time.Minute
+	inf := &informers{
+		externalSecrets: factory.NewInformer(o.Namespace, resyncPeriod),
+		secrets: coreinformers.NewFilteredSecretInformer(o.KubeClient, o.Namespace, resyncPeriod, cache.Indexers{}, func(options *metav1.ListOptions) {
+			options.LabelSelector = o.SecretLabelSelector
+			options.FieldSelector = o.SecretFieldSelector
+		}),
+		stop: stop,
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			onChange()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			onChange()
+		},
+		DeleteFunc: func(obj interface{}) {
+			onChange()
+		},
+	}
+	for _, informer := range []cache.SharedIndexInformer{inf.externalSecrets, inf.secrets} {
+		_, err = informer.AddEventHandler(handler)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to add event handler")
+		}
+		go informer.Run(stop)
+	}
+	o.informers = inf
+	return true, nil
+}
+
+// ready returns true if the informers are still running and their caches have been populated
+func (i *informers) ready() bool {
+	select {
+	case <-i.stop:
+		return false
+	default:
+		return i.externalSecrets.HasSynced() && i.secrets.HasSynced()
+	}
+}
+
+// loadFromInformers loads the secret pairs from the informer caches
+func (o *Options) loadFromInformers() ([]*SecretPair, error) {
+	var answer []*SecretPair
+	var resources []*v1.ExternalSecret
+	for _, obj := range o.informers.externalSecrets.GetStore().List() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		r := &v1.ExternalSecret{}
+		err := extsecrets.FromUnstructured(u, r)
+		if err != nil {
+			return answer, errors.Wrapf(err, "failed to convert to ExternalSecret %s", u.GetName())
+		}
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		r1 := resources[i]
+		r2 := resources[j]
+		if r1.Namespace != r2.Namespace {
+			return r1.Namespace < r2.Namespace
+		}
+		return r1.Name < r2.Name
+	})
+	o.ExternalSecrets = resources
+
+	secrets := o.informers.secrets.GetStore()
+	for _, r := range resources {
+		ns := r.Namespace
+		if ns == "" {
+			ns = o.Namespace
+		}
+		if ns == "" {
+			log.Logger().Warnf("no namespace found for ExternalSecret %s", r.Name)
+			continue
+		}
+		var secret *corev1.Secret
+		obj, exists, err := secrets.GetByKey(ns + "/" + r.Name)
+		if err != nil {
+			return answer, errors.Wrapf(err, "failed to find Secret %s in namespace %s", r.Name, ns)
+		}
+		if exists {
+			secret, _ = obj.(*corev1.Secret)
+		}
+		answer = append(answer, &SecretPair{
+			ExternalSecret: *r,
+			Secret:         secret,
+		})
+	}
+	return answer, nil
+}
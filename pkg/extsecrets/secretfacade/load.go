@@ -6,12 +6,29 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// Load loads the secret pairs
+// Load loads the secret pairs from the informer caches once they have synced if StartInformers has been called otherwise from the API server
+//
+// If LoadTimeout is specified then loading from the API server fails if it takes longer than the timeout
 func (o *Options) Load() ([]*SecretPair, error) {
+	ctx := context.Background()
+	if o.LoadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.LoadTimeout)
+		defer cancel()
+	}
+	return o.LoadContext(ctx)
+}
+
+// LoadContext loads the secret pairs using the given context when querying the API server.
+//
+// The Secrets are listed once per namespace using the SecretLabelSelector and SecretFieldSelector then joined to the
+// ExternalSecrets by name. If the Secrets cannot be listed then each Secret is fetched individually instead
+func (o *Options) LoadContext(ctx context.Context) ([]*SecretPair, error) {
 	var answer []*SecretPair
 	var err error
 
@@ -20,6 +37,10 @@ func (o *Options) Load() ([]*SecretPair, error) {
 		return answer, errors.Wrapf(err, "failed to create kube Client")
 	}
 
+	if o.informers != nil && o.informers.ready() {
+		return o.loadFromInformers()
+	}
+
 	resources, err := o.SecretClient.List(o.Namespace)
 	if err != nil {
 		return answer, errors.Wrap(err, "failed to find external secrets")
@@ -28,6 +49,7 @@ func (o *Options) Load() ([]*SecretPair, error) {
 
 	log.Logger().Debugf("found %d ExternalSecret resources", len(resources))
 
+	secretsByNamespace := map[string]map[string]*corev1.Secret{}
 	for _, r := range resources {
 		if r == nil {
 			continue
@@ -42,12 +64,23 @@ func (o *Options) Load() ([]*SecretPair, error) {
 			continue
 		}
 
-		secret, err := o.KubeClient.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
-		if err != nil && apierrors.IsNotFound(err) {
-			err = nil
+		secrets, ok := secretsByNamespace[ns]
+		if !ok {
+			secrets, err = o.listSecrets(ctx, ns)
+			if err != nil {
+				return answer, err
+			}
+			secretsByNamespace[ns] = secrets
 		}
-		if err != nil {
-			return answer, errors.Wrapf(err, "failed to find Secret %s in namespace %s", name, ns)
+
+		var secret *corev1.Secret
+		if secrets != nil {
+			secret = secrets[name]
+		} else {
+			secret, err = o.getSecret(ctx, ns, name)
+			if err != nil {
+				return answer, err
+			}
 		}
 		answer = append(answer, &SecretPair{
 			ExternalSecret: *r,
@@ -56,3 +89,37 @@ func (o *Options) Load() ([]*SecretPair, error) {
 	}
 	return answer, nil
 }
+
+// listSecrets lists the Secrets in the namespace indexed by name.
+// Returns nil if the user is not permitted to list Secrets so that they are fetched individually
+func (o *Options) listSecrets(ctx context.Context, ns string) (map[string]*corev1.Secret, error) {
+	list, err := o.KubeClient.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.SecretLabelSelector,
+		FieldSelector: o.SecretFieldSelector,
+	})
+	if err != nil && apierrors.IsForbidden(err) {
+		log.Logger().Debugf("not permitted to list Secrets in namespace %s so getting them individually: %s", ns, err.Error())
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list Secrets in namespace %s", ns)
+	}
+	answer := make(map[string]*corev1.Secret, len(list.Items))
+	for i := range list.Items {
+		secret := &list.Items[i]
+		answer[secret.Name] = secret
+	}
+	return answer, nil
+}
+
+// getSecret gets the Secret or returns nil if it does not exist
+func (o *Options) getSecret(ctx context.Context, ns, name string) (*corev1.Secret, error) {
+	secret, err := o.KubeClient.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find Secret %s in namespace %s", name, ns)
+	}
+	return secret, nil
+}
@@ -0,0 +1,130 @@
+package secretfacade_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeSecretClient returns the ExternalSecrets without a dynamic client
+type fakeSecretClient struct {
+	resources []*v1.ExternalSecret
+}
+
+func (c *fakeSecretClient) List(ns string) ([]*v1.ExternalSecret, error) {
+	var answer []*v1.ExternalSecret
+	for _, r := range c.resources {
+		if ns == "" || r.Namespace == ns {
+			answer = append(answer, r)
+		}
+	}
+	return answer, nil
+}
+
+func createResources(namespaces []string, count int) ([]*v1.ExternalSecret, []runtime.Object) {
+	var resources []*v1.ExternalSecret
+	var secrets []runtime.Object
+	for i := 0; i < count; i++ {
+		ns := namespaces[i%len(namespaces)]
+		name := fmt.Sprintf("secret-%d", i)
+		resources = append(resources, &v1.ExternalSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: v1.ExternalSecretSpec{
+				Data: []v1.Data{
+					{Name: "token", Key: name, Property: "token"},
+				},
+			},
+		})
+		// lets leave every 10th secret missing
+		if i%10 == 0 {
+			continue
+		}
+		secrets = append(secrets, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: map[string]string{
+					"app": "jx",
+				},
+			},
+			Data: map[string][]byte{
+				"token": []byte("my-token"),
+			},
+		})
+	}
+	return resources, secrets
+}
+
+func TestLoadListsSecretsPerNamespace(t *testing.T) {
+	namespaces := []string{"jx", "tekton-pipelines", "nginx"}
+	resources, secrets := createResources(namespaces, 30)
+	kubeClient := fake.NewSimpleClientset(secrets...)
+
+	o := &secretfacade.Options{
+		SecretClient:        &fakeSecretClient{resources: resources},
+		KubeClient:          kubeClient,
+		SecretLabelSelector: "app=jx",
+		LoadTimeout:         time.Minute,
+	}
+	pairs, err := o.Load()
+	require.NoError(t, err, "failed to load")
+	require.Len(t, pairs, 30, "pairs")
+
+	for i, p := range pairs {
+		if i%10 == 0 {
+			assert.Nil(t, p.Secret, "should not have found Secret %s", p.Key())
+			continue
+		}
+		require.NotNil(t, p.Secret, "should have found Secret %s", p.Key())
+		assert.Equal(t, p.Name(), p.Secret.Name, "secret name")
+		assert.Equal(t, p.Namespace(), p.Secret.Namespace, "secret namespace")
+	}
+
+	lists := 0
+	for _, a := range kubeClient.Actions() {
+		assert.NotEqual(t, "get", a.GetVerb(), "should not get individual Secrets")
+		if a.GetVerb() == "list" {
+			lists++
+		}
+	}
+	assert.Equal(t, len(namespaces), lists, "should list the Secrets once per namespace")
+
+	// lets check the selector is used
+	o.SecretLabelSelector = "app=other"
+	pairs, err = o.Load()
+	require.NoError(t, err, "failed to load")
+	for _, p := range pairs {
+		assert.Nil(t, p.Secret, "should not have found Secret %s with a different label", p.Key())
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	resources, secrets := createResources([]string{"jx", "tekton-pipelines", "nginx", "jx-staging", "jx-production"}, 500)
+	o := &secretfacade.Options{
+		SecretClient: &fakeSecretClient{resources: resources},
+		KubeClient:   fake.NewSimpleClientset(secrets...),
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pairs, err := o.Load()
+		if err != nil {
+			b.Fatalf("failed to load: %s", err.Error())
+		}
+		if len(pairs) != 500 {
+			b.Fatalf("expected 500 pairs but got %d", len(pairs))
+		}
+	}
+}
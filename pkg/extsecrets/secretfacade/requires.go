@@ -0,0 +1,145 @@
+package secretfacade
+
+import (
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/requires"
+	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/maps"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+)
+
+// CreateRequirementsMap creates the requirements map used by templates and requires expressions
+func CreateRequirementsMap(req *jxcore.RequirementsConfig) (map[string]interface{}, error) {
+	requirementsMap, err := req.ToMap()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed turn requirements into a map: %v", req)
+	}
+	if requirementsMap["storage"] == nil {
+		requirementsMap["storage"] = map[string]string{}
+	}
+	if requirementsMap["cluster"] == nil {
+		requirementsMap["cluster"] = map[string]string{}
+	}
+	if maps.GetMapValueAsStringViaPath(requirementsMap, "cluster.registry") == "" {
+		maps.SetMapValueViaPath(requirementsMap, "cluster.registry", "")
+	}
+	return requirementsMap, nil
+}
+
+// RequirementsMap lazily loads the jx-requirements.yml file in the directory and returns its requirements map.
+// Returns nil if there is no Requirements and no jx-requirements.yml file
+func (o *Options) RequirementsMap() (map[string]interface{}, error) {
+	if o.requirementsMap != nil || o.requirementsMissing {
+		return o.requirementsMap, nil
+	}
+	if o.Requirements == nil {
+		fileName := filepath.Join(o.Dir, jxcore.RequirementsConfigFileName)
+		exists, err := files.FileExists(fileName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check if file exists %s", fileName)
+		}
+		if !exists {
+			log.Logger().Debugf("no %s file so requires expressions using the requirements are ignored", fileName)
+			o.requirementsMissing = true
+			return nil, nil
+		}
+		requirementsResource, _, err := jxcore.LoadRequirementsConfig(o.Dir, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load jx-requirements.yml in dir %s", o.Dir)
+		}
+		o.Requirements = &requirementsResource.Spec
+	}
+	var err error
+	o.requirementsMap, err = CreateRequirementsMap(o.Requirements)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create requirements map")
+	}
+	return o.requirementsMap, nil
+}
+
+// IsRequired returns true if the entry of the secret is required by evaluating the requires expression of its schema property
+// against the requirements and the values of the other entries in the secret.
+//
+// Entries without a schema property or requires expression are always required. If the expression uses the requirements
+// and they cannot be found then the entry is also required.
+func (o *Options) IsRequired(p *SecretPair, name string) (bool, error) {
+	obj, err := p.SchemaObject()
+	if err != nil || obj == nil {
+		return true, err
+	}
+	property := obj.FindProperty(name)
+	if property == nil || strings.TrimSpace(property.Requires) == "" {
+		return true, nil
+	}
+	expression, err := requires.Parse(property.Requires)
+	if err != nil {
+		return true, errors.Wrapf(err, "invalid requires expression for property %s of secret %s", name, p.Name())
+	}
+	requirementsMap, err := o.RequirementsMap()
+	if err != nil {
+		return true, err
+	}
+	if requirementsMap == nil && usesRequirements(expression) {
+		return true, nil
+	}
+
+	variables := map[string]interface{}{}
+	for k, v := range requirementsMap {
+		variables[k] = v
+	}
+	values := map[string]string{}
+	if p.Secret != nil {
+		for k, v := range p.Secret.Data {
+			values[k] = string(v)
+		}
+	}
+	variables[requires.PropertiesKey] = values
+	return expression.Evaluate(variables), nil
+}
+
+// RequiredData returns the data entries of the ExternalSecret which are required
+func (o *Options) RequiredData(p *SecretPair) ([]v1.Data, error) {
+	var answer []v1.Data
+	for _, d := range p.ExternalSecret.Spec.Data {
+		required, err := o.IsRequired(p, d.Name)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			answer = append(answer, d)
+		} else {
+			log.Logger().Debugf("entry %s of secret %s is not required", d.Name, p.Name())
+		}
+	}
+	return answer, nil
+}
+
+// VerifyRequired verifies the required entries of the secret are populated
+func (o *Options) VerifyRequired(p *SecretPair) (*SecretError, error) {
+	data, err := o.RequiredData(p)
+	if err != nil {
+		return nil, err
+	}
+	es := p.ExternalSecret
+	es.Spec.Data = data
+	result, err := VerifySecret(&es, p.Secret)
+	if result != nil {
+		result.ExternalSecret = p.ExternalSecret
+	}
+	return result, err
+}
+
+// usesRequirements returns true if the expression uses any variables other than the properties
+func usesRequirements(expression *requires.Expression) bool {
+	for _, path := range expression.Paths() {
+		if path != requires.PropertiesKey && !strings.HasPrefix(path, requires.PropertiesKey+".") {
+			return true
+		}
+	}
+	return false
+}
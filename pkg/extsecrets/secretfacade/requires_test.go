@@ -0,0 +1,83 @@
+package secretfacade_test
+
+import (
+	"testing"
+
+	v1 "github.com/jenkins-x-plugins/jx-secret/pkg/apis/external/v1"
+	schema "github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/secretfacade"
+	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerifyRequired(t *testing.T) {
+	p := &secretfacade.SecretPair{
+		ExternalSecret: v1.ExternalSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-secret",
+				Namespace: "jx",
+			},
+			Spec: v1.ExternalSecretSpec{
+				Data: []v1.Data{
+					{Name: "username", Key: "my-secret", Property: "username"},
+					{Name: "password", Key: "my-secret", Property: "password"},
+					{Name: "gke-key", Key: "my-secret", Property: "gke-key"},
+					{Name: "eks-key", Key: "my-secret", Property: "eks-key"},
+				},
+			},
+		},
+		Secret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "my-secret",
+				Namespace: "jx",
+			},
+			Data: map[string][]byte{
+				"username": []byte("admin"),
+			},
+		},
+	}
+	p.SetSchemaObject(&schema.Object{
+		Name: "my-secret",
+		Properties: []schema.Property{
+			{Name: "username"},
+			{Name: "password", Requires: "properties.username"},
+			{Name: "gke-key", Requires: `cluster.provider == "gke"`},
+			{Name: "eks-key", Requires: `cluster.provider == "eks"`},
+		},
+	})
+
+	o := &secretfacade.Options{
+		Requirements: &jxcore.RequirementsConfig{
+			Cluster: jxcore.ClusterConfig{
+				Provider: "gke",
+			},
+		},
+	}
+
+	result, err := o.VerifyRequired(p)
+	require.NoError(t, err, "failed to verify")
+	require.NotNil(t, result, "should have a secret error")
+	require.Len(t, result.EntryErrors, 1, "entry errors")
+	assert.Equal(t, []string{"password", "gke-key"}, result.EntryErrors[0].Properties, "missing properties")
+	assert.Len(t, result.ExternalSecret.Spec.Data, 4, "should return the original ExternalSecret")
+
+	// without a username the password is not required
+	p.Secret.Data = map[string][]byte{}
+	required, err := o.IsRequired(p, "password")
+	require.NoError(t, err, "failed to evaluate password")
+	assert.False(t, required, "password should not be required without a username")
+
+	// without requirements we conservatively require entries whose expressions use them
+	o = &secretfacade.Options{Dir: "test_data"}
+	for _, name := range []string{"username", "gke-key", "eks-key"} {
+		required, err = o.IsRequired(p, name)
+		require.NoError(t, err, "failed to evaluate %s", name)
+		assert.True(t, required, "%s should be required without requirements", name)
+	}
+	required, err = o.IsRequired(p, "password")
+	require.NoError(t, err, "failed to evaluate password")
+	assert.False(t, required, "password should not be required without a username")
+}
@@ -0,0 +1,212 @@
+package secretfacade
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/mapping/v1alpha1"
+	schema "github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
+)
+
+// SharedDestination a location in the secret store which is used by more than one ExternalSecret
+type SharedDestination struct {
+	// Destination the location in the secret store from the secret mappings
+	Destination string
+
+	// Entries the entries using the destination with the canonical secret first
+	Entries []*SharedEntry
+
+	// Pinned the canonical secret is pinned in the secret mappings
+	Pinned bool
+
+	// SchemaConflicts describes where the schema properties of the entries disagree
+	SchemaConflicts []string
+}
+
+// SharedEntry an entry of an ExternalSecret which uses a shared destination
+type SharedEntry struct {
+	// Secret the secret
+	Secret *SecretPair
+
+	// Name the name of the entry in the Secret
+	Name string
+}
+
+// entryDestination the location in the secret store of an entry of an ExternalSecret
+type entryDestination struct {
+	// Name the name of the entry in the Secret
+	Name string
+
+	// Destination the location in the secret store from the secret mappings
+	Destination string
+}
+
+// Canonical returns the canonical secret which is edited and populated for the destination
+func (d *SharedDestination) Canonical() *SecretPair {
+	if len(d.Entries) == 0 {
+		return nil
+	}
+	return d.Entries[0].Secret
+}
+
+// FindSharedDestinations returns the locations in the secret store which are used by more than one ExternalSecret sorted by destination.
+// These are the secrets that VerifyAndFilter filters out so that each location is only populated once.
+//
+// The entries of each destination are in canonical order: any secret pinned as canonical in the secret mappings
+// is first followed by the secrets in schema order
+func FindSharedDestinations(secrets []*SecretPair, secretMapping *v1alpha1.SecretMapping) []*SharedDestination {
+	// lets sort by key first so that the results do not depend on the order the secrets were loaded
+	sorted := append([]*SecretPair{}, secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Key() < sorted[j].Key()
+	})
+
+	m := map[string]*SharedDestination{}
+	for _, s := range sorted {
+		for _, dest := range destinations(s, secretMapping) {
+			sd := m[dest.Destination]
+			if sd == nil {
+				sd = &SharedDestination{Destination: dest.Destination}
+				m[dest.Destination] = sd
+			}
+			found := false
+			for _, e := range sd.Entries {
+				if e.Secret == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				sd.Entries = append(sd.Entries, &SharedEntry{Secret: s, Name: dest.Name})
+			}
+		}
+	}
+
+	var answer []*SharedDestination
+	for _, sd := range m {
+		if len(sd.Entries) < 2 {
+			continue
+		}
+		sortEntriesInCanonicalOrder(sd.Entries, secretMapping)
+		canonical := sd.Canonical()
+		sd.Pinned = secretMapping != nil && secretMapping.IsCanonical(canonical.Namespace(), canonical.Name())
+		sd.SchemaConflicts = schemaConflicts(sd.Entries)
+		answer = append(answer, sd)
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Destination < answer[j].Destination
+	})
+	return answer
+}
+
+// destinations returns the locations in the secret store of the entries of the secret from its rule in the secret mappings
+func destinations(s *SecretPair, secretMapping *v1alpha1.SecretMapping) []entryDestination {
+	if secretMapping == nil {
+		return nil
+	}
+	var answer []entryDestination
+	rule := secretMapping.FindRule(s.Namespace(), s.Name())
+	for i := range rule.Mappings {
+		mapping := &rule.Mappings[i]
+		answer = append(answer, entryDestination{
+			Name:        mapping.Name,
+			Destination: secretMapping.DestinationString(rule, mapping),
+		})
+	}
+	return answer
+}
+
+// SortSecretsInCanonicalOrder sorts the secrets with any secrets pinned as canonical in the secret mappings first
+// followed by the secrets in schema order
+func SortSecretsInCanonicalOrder(resources []*SecretPair, secretMapping *v1alpha1.SecretMapping) {
+	SortSecretsInSchemaOrder(resources)
+	if secretMapping == nil {
+		return
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return secretMapping.IsCanonical(resources[i].Namespace(), resources[i].Name()) &&
+			!secretMapping.IsCanonical(resources[j].Namespace(), resources[j].Name())
+	})
+}
+
+func sortEntriesInCanonicalOrder(entries []*SharedEntry, secretMapping *v1alpha1.SecretMapping) {
+	var secrets []*SecretPair
+	names := map[*SecretPair]string{}
+	for _, e := range entries {
+		secrets = append(secrets, e.Secret)
+		names[e.Secret] = e.Name
+	}
+	SortSecretsInCanonicalOrder(secrets, secretMapping)
+	for i, s := range secrets {
+		entries[i] = &SharedEntry{Secret: s, Name: names[s]}
+	}
+}
+
+// schemaConflicts returns descriptions of the schema properties of the entries which disagree
+func schemaConflicts(entries []*SharedEntry) []string {
+	type propertyField struct {
+		name  string
+		value func(p *schema.Property) string
+	}
+	fields := []propertyField{
+		{"generator", func(p *schema.Property) string { return p.Generator }},
+		{"template", func(p *schema.Property) string { return p.Template }},
+		{"default value", func(p *schema.Property) string { return p.DefaultValue }},
+		{"format", func(p *schema.Property) string { return p.Format }},
+		{"pattern", func(p *schema.Property) string { return p.Pattern }},
+		{"minimum length", func(p *schema.Property) string { return intText(p.MinLength) }},
+		{"maximum length", func(p *schema.Property) string { return intText(p.MaxLength) }},
+		{"requires", func(p *schema.Property) string { return p.Requires }},
+	}
+
+	var answer []string
+	var withSchema, withoutSchema []string
+	properties := map[string]*schema.Property{}
+	for _, e := range entries {
+		key := e.Secret.Key()
+		obj, _ := e.Secret.SchemaObject()
+		var property *schema.Property
+		if obj != nil {
+			property = obj.FindProperty(e.Name)
+		}
+		if property == nil {
+			withoutSchema = append(withoutSchema, key)
+			continue
+		}
+		withSchema = append(withSchema, key)
+		properties[key] = property
+	}
+	if len(withSchema) > 0 && len(withoutSchema) > 0 {
+		answer = append(answer, fmt.Sprintf("no schema property for %s", strings.Join(withoutSchema, ", ")))
+	}
+	if len(withSchema) < 2 {
+		return answer
+	}
+	for _, f := range fields {
+		first := f.value(properties[withSchema[0]])
+		differs := false
+		for _, key := range withSchema[1:] {
+			if f.value(properties[key]) != first {
+				differs = true
+				break
+			}
+		}
+		if !differs {
+			continue
+		}
+		var values []string
+		for _, key := range withSchema {
+			values = append(values, fmt.Sprintf("%s=%q", key, f.value(properties[key])))
+		}
+		answer = append(answer, fmt.Sprintf("the %s differs: %s", f.name, strings.Join(values, ", ")))
+	}
+	return answer
+}
+
+func intText(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", value)
+}
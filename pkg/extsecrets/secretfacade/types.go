@@ -2,6 +2,7 @@ package secretfacade
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
 	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore/factory"
+	jxcore "github.com/jenkins-x/jx-api/v4/pkg/apis/core/v4beta1"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
@@ -24,13 +26,33 @@ type Options struct {
 	Namespace                 string
 	SecretNamespace           string
 	Filter                    string
+	SecretFilter              SecretFilter
 	SecretClient              extsecrets.Interface
 	KubeClient                kubernetes.Interface
 	Source                    string
 	SecretStoreManagerFactory secretstore.FactoryInterface
 
+	// SecretLabelSelector the optional label selector used when listing Secrets
+	SecretLabelSelector string
+
+	// SecretFieldSelector the optional field selector used when listing Secrets such as to omit helm release Secrets
+	SecretFieldSelector string
+
+	// LoadTimeout the optional maximum amount of time to load the ExternalSecrets and Secrets from the API server
+	LoadTimeout time.Duration
+
 	// ExternalSecrets the loaded secrets
 	ExternalSecrets []*v1.ExternalSecret
+
+	// Requirements the optional requirements used to evaluate requires expressions and templates
+	// which are lazily loaded from the jx-requirements.yml file in the directory if not specified
+	Requirements *jxcore.RequirementsConfig
+
+	// informers the optional informer caches used by Load
+	informers *informers
+
+	requirementsMap     map[string]interface{}
+	requirementsMissing bool
 }
 
 type ExternalSecretLocation string
@@ -42,6 +64,7 @@ func (o *Options) AddFlags(cmd *cobra.Command) {
 	o.BaseOptions.AddBaseFlags(cmd)
 
 	cmd.Flags().StringVarP(&o.Filter, "filter", "f", "", "the filter to filter on ExternalSecret names")
+	o.SecretFilter.AddFlags(cmd)
 	cmd.Flags().StringVarP(&o.Source, "source", "s", "kubernetes", "the source location for the ExternalSecrets, valid values include filesystem or kubernetes")
 }
 
@@ -64,7 +87,7 @@ func (o *Options) Validate() error {
 	if o.SecretStoreManagerFactory == nil {
 		o.SecretStoreManagerFactory = &factory.SecretManagerFactory{}
 	}
-	return nil
+	return o.SecretFilter.Validate()
 }
 
 func (o *Options) ExternalSecretByName(secretName string) (*v1.ExternalSecret, error) {
@@ -94,6 +117,42 @@ type EntryError struct {
 	Properties []string
 }
 
+// ValueError represents a secret entry whose value does not match the schema property
+type ValueError struct {
+	// Name the name of the entry in the Secret
+	Name string
+
+	// Messages the descriptions of the validation failures which never include the value
+	Messages []string
+}
+
+// SyncError represents an ExternalSecret which the controller has not synchronised
+type SyncError struct {
+	// ExternalSecret the external secret which is not synchronised
+	ExternalSecret v1.ExternalSecret
+
+	// Status the status reported by the controller
+	Status string
+
+	// Failed the controller reported a status other than success
+	Failed bool
+
+	// Stale the controller has not observed the latest generation of the ExternalSecret
+	Stale bool
+}
+
+// Message returns a description of the sync error
+func (e *SyncError) Message() string {
+	switch {
+	case e.Failed && e.Stale:
+		return fmt.Sprintf("sync failed with status %s and generation %d not observed", e.Status, e.ExternalSecret.Generation)
+	case e.Failed:
+		return fmt.Sprintf("sync failed with status %s", e.Status)
+	default:
+		return fmt.Sprintf("generation %d not observed by the controller", e.ExternalSecret.Generation)
+	}
+}
+
 // SecretPair the external secret and the associated Secret an error for a secret
 type SecretPair struct {
 	// ExternalSecret the external secret which is not valid
@@ -105,6 +164,12 @@ type SecretPair struct {
 	// Error last validation error at last check
 	Error *SecretError
 
+	// SyncError the controller sync error at last check
+	SyncError *SyncError
+
+	// ValueErrors the entries whose values do not match the schema at last check
+	ValueErrors []*ValueError
+
 	// schemaObject caches the schema object
 	schemaObject *schema.Object
 }
@@ -1,8 +1,6 @@
 package secretfacade
 
 import (
-	"strings"
-
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
 )
@@ -17,17 +15,21 @@ func (o *Options) Verify() ([]*SecretPair, error) {
 
 	for _, p := range pairs {
 		r := p.ExternalSecret
-		secret := p.Secret
 		name := r.Name
-		if o.Filter != "" && !strings.Contains(name, o.Filter) {
+		if !o.Matches(p) {
 			continue
 		}
 		ns := r.Namespace
-		result, err := VerifySecret(&r, secret)
+		result, err := o.VerifyRequired(p)
 		if err != nil {
 			return pairs, errors.Wrapf(err, "failed to verify secret %s in namespace %s", name, ns)
 		}
 		p.Error = result
+		p.SyncError = VerifySyncStatus(&r)
+		p.ValueErrors, err = VerifyValues(p)
+		if err != nil {
+			return pairs, errors.Wrapf(err, "failed to validate the values of secret %s in namespace %s", name, ns)
+		}
 	}
 	return pairs, nil
 }
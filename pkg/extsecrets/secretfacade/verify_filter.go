@@ -10,61 +10,39 @@ import (
 )
 
 // VerifyAndFilter loads the secrets and verifies which are valid to aid the populate operations
-// then filters out any duplicate entries which are using the same underlying secret mappings.
+// then filters out any duplicate entries which are using the same locations in the secret store.
 //
 // e.g. if 2 secrets are populated to the same actual location then we can omit one of them since there's no need
 // to write to the same location twice.
 //
-// We prefer the secrets which have schemas associated and that have the most entries.
+// We prefer the secrets which are pinned as canonical in the secret mappings then those which have schemas associated
+// and that have the most entries.
 func (o *Options) VerifyAndFilter() ([]*SecretPair, error) {
 	secrets, err := o.Verify()
 	if err != nil {
 		return secrets, err
 	}
 
-	// lets filter out any secrets with similar secret mapping locations...
 	secretMapping, _, err := secretmapping.LoadSecretMapping(o.Dir, false)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to load secret mappings in dir %s", o.Dir)
 	}
 
-	destinations := map[string][]*SecretPair{}
-
-	if secretMapping != nil {
-		// lets iterate through all objects + keep track of the properties and locations
-
-		for _, s := range secrets {
-			es := s.ExternalSecret
-			_, err := s.SchemaObject()
-			if err != nil {
-				return secrets, errors.Wrapf(err, "failed to load the schema object for %s", es.Name)
-			}
-
-			secretRule := secretMapping.FindRule(es.Namespace, es.Name)
-			if secretRule != nil {
-				for i := range secretRule.Mappings {
-					mapping := &secretRule.Mappings[i]
-					destination := secretMapping.DestinationString(secretRule, mapping)
-
-					destinations[destination] = append(destinations[destination], s)
-				}
-			}
-
+	for _, s := range secrets {
+		_, err = s.SchemaObject()
+		if err != nil {
+			return secrets, errors.Wrapf(err, "failed to load the schema object for %s", s.ExternalSecret.Name)
 		}
 	}
 
+	// lets filter out any secrets which share a destination with a more canonical secret
 	filterKeys := map[string]bool{}
-	for destination, secrets := range destinations {
-		if len(secrets) < 2 {
-			continue
-		}
-
-		// lets filter out any unnecessary secrets
-		SortSecretsInSchemaOrder(secrets)
-		for i := 1; i < len(secrets); i++ {
-			key := secrets[i].Key()
+	for _, sd := range FindSharedDestinations(secrets, secretMapping) {
+		canonical := sd.Canonical()
+		for _, e := range sd.Entries[1:] {
+			key := e.Secret.Key()
 			if !filterKeys[key] {
-				log.Logger().Debugf("filtering out Secret %s as %s is better for schema editing and it uses the same destination %s", secrets[i].Name(), secrets[0].Name(), destination)
+				log.Logger().Debugf("filtering out Secret %s as %s is better for schema editing and it uses the same destination %s", key, canonical.Key(), sd.Destination)
 				filterKeys[key] = true
 			}
 		}
@@ -0,0 +1,30 @@
+package testsecrets
+
+import (
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+)
+
+// FailingSecretManagerFactory creates secret stores which fail to read or write any secret with the given error
+// such as a permission or network failure
+type FailingSecretManagerFactory struct {
+	Err error
+}
+
+var _ secretstore.FactoryInterface = &FailingSecretManagerFactory{}
+
+// NewSecretManager creates a failing secret store
+func (f *FailingSecretManagerFactory) NewSecretManager(_ secretstore.Type) (secretstore.Interface, error) {
+	return &failingSecretStore{err: f.Err}, nil
+}
+
+type failingSecretStore struct {
+	err error
+}
+
+func (s *failingSecretStore) GetSecret(_, _, _ string) (string, error) {
+	return "", s.err
+}
+
+func (s *failingSecretStore) SetSecret(_, _ string, _ *secretstore.SecretValue) error {
+	return s.err
+}
@@ -0,0 +1,39 @@
+package masker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// Hasher creates short keyed hashes of secret values so that values can be compared in the output of a command
+// without revealing them.
+//
+// The key is random for each Hasher so a hash cannot be used to guess a low entropy value like a password
+// and hashes can only be compared with other hashes from the same Hasher
+type Hasher struct {
+	key []byte
+}
+
+// NewHasher creates a Hasher with a random key
+func NewHasher() (*Hasher, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate a random hash key")
+	}
+	return &Hasher{key: key}, nil
+}
+
+// Hash returns a short keyed hash of the value or a blank string if the value is blank
+func (h *Hasher) Hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
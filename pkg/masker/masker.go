@@ -3,6 +3,7 @@ package masker
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
@@ -69,6 +70,39 @@ var (
 type Client struct {
 	ReplaceWords map[string]string
 	LogFn        func(string)
+
+	replacer *strings.Replacer
+	maxLines int
+}
+
+// NewCompiledClient creates a client for the given replace words which are compiled
+// so that Mask replaces them all in a single pass over the text.
+//
+// The replace words must not be modified after calling this function
+func NewCompiledClient(replaceWords map[string]string) *Client {
+	m := &Client{ReplaceWords: replaceWords}
+	m.Compile()
+	return m
+}
+
+// Compile compiles the current replace words so that Mask replaces them all in a single pass.
+// Loading any more secrets discards the compiled form
+func (m *Client) Compile() {
+	words := m.GetReplacedWords()
+
+	// lets replace the longest words first in case a secret value contains another
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	oldnew := make([]string, 0, len(words)*2)
+	for _, w := range words {
+		oldnew = append(oldnew, w, m.ReplaceWords[w])
+	}
+	m.replacer = strings.NewReplacer(oldnew...)
+	m.maxLines = maxLines(words)
 }
 
 // NewMasker creates a new Client loading secrets from the given namespace
@@ -179,6 +213,7 @@ func (m *Client) LoadSecret(secret *corev1.Secret) error {
 				}
 				m.LogFn(fmt.Sprintf("adding mask of secret %s entry %s %s", info(secretName), info(name), password))
 				m.ReplaceWords[value] = m.replaceValue(value)
+				m.replacer = nil
 			}
 		}
 	}
@@ -187,6 +222,9 @@ func (m *Client) LoadSecret(secret *corev1.Secret) error {
 
 // Mask returns the text with all of the secrets masked out
 func (m *Client) Mask(text string) string {
+	if m.replacer != nil {
+		return m.replacer.Replace(text)
+	}
 	answer := text
 	for k, v := range m.ReplaceWords {
 		answer = strings.Replace(answer, k, v, -1)
@@ -194,6 +232,43 @@ func (m *Client) Mask(text string) string {
 	return answer
 }
 
+// Indexes returns the sorted byte offsets in the text of each secret value
+func (m *Client) Indexes(text string) []int {
+	var answer []int
+	for k := range m.ReplaceWords {
+		for offset := 0; offset < len(text); {
+			i := strings.Index(text[offset:], k)
+			if i < 0 {
+				break
+			}
+			answer = append(answer, offset+i)
+			offset += i + len(k)
+		}
+	}
+	sort.Ints(answer)
+	return answer
+}
+
+// MaxLines returns the largest number of lines spanned by a secret value so that text masked a line at a time
+// can hold back enough lines to mask multi line values such as PEM keys
+func (m *Client) MaxLines() int {
+	if m.replacer != nil {
+		return m.maxLines
+	}
+	return maxLines(m.GetReplacedWords())
+}
+
+func maxLines(words []string) int {
+	answer := 1
+	for _, w := range words {
+		lines := strings.Count(w, "\n") + 1
+		if lines > answer {
+			answer = lines
+		}
+	}
+	return answer
+}
+
 // MaskData masks the given data
 func (m *Client) MaskData(logData []byte) []byte {
 	text := m.Mask(string(logData))
@@ -96,3 +96,12 @@ func TestMasker(t *testing.T) {
 		}
 	}
 }
+
+func TestCompiledMasker(t *testing.T) {
+	m := masker.NewCompiledClient(map[string]string{
+		"secret":       masker.MaskedOut,
+		"secret-value": masker.MaskedOut,
+	})
+
+	assert.Equal(t, "a "+masker.MaskedOut+" and "+masker.MaskedOut, m.Mask("a secret-value and secret"), "should replace the longest values first")
+}
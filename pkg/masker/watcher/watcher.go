@@ -1,8 +1,11 @@
 package watcher
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
@@ -12,19 +15,47 @@ import (
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/tools/cache"
 )
 
+// DefaultDebounceDelay the default delay before compiling the masker after a secret is deleted
+const DefaultDebounceDelay = 100 * time.Millisecond
+
+// emptyClient the client used before any secrets are compiled
+var emptyClient = masker.NewCompiledClient(map[string]string{})
+
 type Options struct {
 	Namespaces []string
-	KubeClient kubernetes.Interface
+	// NamespaceSelector the optional label selector of additional namespaces to watch
+	NamespaceSelector string
+	KubeClient        kubernetes.Interface
+	// DebounceDelay the delay after a secret is deleted before the masker is compiled so that bursts of deletes are only compiled once.
+	// Added and updated secrets are always compiled straight away so that new values are never shown. Defaults to DefaultDebounceDelay
+	DebounceDelay time.Duration
 
+	// replaceWordMapLock guards the replace words and compile state below
 	replaceWordMap     map[string]map[string]string
 	replaceWordMapLock sync.Mutex
+	dirty              bool
+	listing            map[string]bool
+	compileTimer       *time.Timer
+	client             atomic.Pointer[masker.Client]
 	loggedMessages     map[string]bool
+	loggedMessagesLock sync.Mutex
+
+	// namespaceLock guards the namespace watching state below
+	namespaceLock     sync.Mutex
+	namespaceStops    map[string]chan struct{}
+	synced            map[string]cache.InformerSynced
+	namespacesSynced  cache.InformerSynced
+	cancel            context.CancelFunc
+	namespaceSelector labels.Selector
 }
 
 // Validate verifies things are setup correctly
@@ -32,15 +63,31 @@ func (o *Options) Validate() error {
 	if o.replaceWordMap == nil {
 		o.replaceWordMap = map[string]map[string]string{}
 	}
+	if o.listing == nil {
+		o.listing = map[string]bool{}
+	}
 	if o.loggedMessages == nil {
 		o.loggedMessages = map[string]bool{}
 	}
+	if o.namespaceStops == nil {
+		o.namespaceStops = map[string]chan struct{}{}
+	}
+	if o.synced == nil {
+		o.synced = map[string]cache.InformerSynced{}
+	}
 	var err error
 	o.KubeClient, err = kube.LazyCreateKubeClient(o.KubeClient)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create kube client")
 	}
 
+	if o.NamespaceSelector != "" {
+		o.namespaceSelector, err = labels.Parse(o.NamespaceSelector)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse namespace selector %s", o.NamespaceSelector)
+		}
+	}
+
 	currentNS, err := kubeclient.CurrentNamespace()
 	if err != nil {
 		return errors.Wrapf(err, "failed to find current namespace")
@@ -52,20 +99,39 @@ func (o *Options) Validate() error {
 	return nil
 }
 
-// Run runs the watching masker
+// Run runs the watching masker until Stop is called
 func (o *Options) Run() error {
-	stop := make(chan struct{})
-	err := o.RunWithChannel(stop)
+	return o.RunWithContext(context.Background())
+}
+
+// RunWithContext runs the watching masker until the context is done or Stop is called
+func (o *Options) RunWithContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	o.namespaceLock.Lock()
+	o.cancel = cancel
+	o.namespaceLock.Unlock()
+
+	err := o.RunWithChannel(ctx.Done())
 	if err != nil {
-		return errors.Wrapf(err, "failed to ")
+		return errors.Wrapf(err, "failed to start the secret watchers")
 	}
+	<-ctx.Done()
+	return nil
+}
 
-	// Wait forever
-	select {}
+// Stop stops a watcher started via Run or RunWithContext
+func (o *Options) Stop() {
+	o.namespaceLock.Lock()
+	defer o.namespaceLock.Unlock()
+	if o.cancel != nil {
+		o.cancel()
+	}
 }
 
-// RunWithChannel runs with the given channel
-func (o *Options) RunWithChannel(stop chan struct{}) error {
+// RunWithChannel starts the watchers which run until the given channel is closed
+func (o *Options) RunWithChannel(stop <-chan struct{}) error {
 	err := o.Validate()
 	if err != nil {
 		return errors.Wrapf(err, "failed to validate options")
@@ -74,31 +140,216 @@ func (o *Options) RunWithChannel(stop chan struct{}) error {
 	log.Logger().Info("starting secret watching masker")
 
 	for _, ns := range o.Namespaces {
-		secret := &corev1.Secret{}
-		log.Logger().Infof("Watching for Secret resources in namespace %s", ns)
-		listWatch := cache.NewListWatchFromClient(o.KubeClient.CoreV1().RESTClient(), "secrets", ns, fields.Everything())
-		kube.SortListWatchByName(listWatch)
-		_, ctrl := cache.NewInformerWithOptions(
-			cache.InformerOptions{
-				ListerWatcher: listWatch,
-				ObjectType:    secret,
-				Handler: cache.ResourceEventHandlerFuncs{
-					AddFunc: func(obj interface{}) {
-						o.onSecret(ns, obj)
-					},
-					UpdateFunc: func(oldObj, newObj interface{}) {
-						o.onSecret(ns, newObj)
-					},
-					DeleteFunc: func(obj interface{}) {
-					},
-				},
-				ResyncPeriod: time.Minute * 10,
-			})
-		go ctrl.Run(stop)
+		o.watchNamespace(ns, stop)
+	}
+	if o.namespaceSelector != nil {
+		o.watchNamespaces(stop)
 	}
+	go o.WaitForSync(stop)
 	return nil
 }
 
+// WaitForSync waits for the initial list of secrets to be loaded in every watched namespace.
+//
+// The secrets of each namespace are masked as soon as its own initial list is loaded so this is only needed
+// to know when all the namespaces are masked
+func (o *Options) WaitForSync(stop <-chan struct{}) bool {
+	o.namespaceLock.Lock()
+	namespacesSynced := o.namespacesSynced
+	o.namespaceLock.Unlock()
+
+	if namespacesSynced != nil && !cache.WaitForCacheSync(stop, namespacesSynced) {
+		return false
+	}
+
+	o.namespaceLock.Lock()
+	var synced []cache.InformerSynced
+	for _, fn := range o.synced {
+		synced = append(synced, fn)
+	}
+	o.namespaceLock.Unlock()
+	if !cache.WaitForCacheSync(stop, synced...) {
+		return false
+	}
+
+	o.replaceWordMapLock.Lock()
+	o.compileIfDirty()
+	o.replaceWordMapLock.Unlock()
+	return true
+}
+
+// watchNamespaces watches the namespaces matching the selector, starting and stopping the secret watchers as they come and go
+func (o *Options) watchNamespaces(stop <-chan struct{}) {
+	log.Logger().Infof("Watching for Namespace resources matching selector %s", o.NamespaceSelector)
+	ctx := context.Background()
+	selector := o.namespaceSelector.String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return o.KubeClient.CoreV1().Namespaces().List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return o.KubeClient.CoreV1().Namespaces().Watch(ctx, options)
+		},
+	}
+	_, ctrl := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: listWatch,
+			ObjectType:    &corev1.Namespace{},
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					o.onNamespace(obj, stop)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					o.onNamespace(newObj, stop)
+				},
+				DeleteFunc: func(obj interface{}) {
+					namespace, ok := deletedObject(obj).(*corev1.Namespace)
+					if !ok {
+						log.Logger().Infof("Object is not a Namespace %#v", obj)
+						return
+					}
+					o.unwatchSelectedNamespace(namespace.Name)
+				},
+			},
+			ResyncPeriod: time.Minute * 10,
+		})
+
+	o.namespaceLock.Lock()
+	o.namespacesSynced = ctrl.HasSynced
+	o.namespaceLock.Unlock()
+
+	go ctrl.Run(stop)
+}
+
+func (o *Options) onNamespace(obj interface{}, stop <-chan struct{}) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		log.Logger().Infof("Object is not a Namespace %#v", obj)
+		return
+	}
+	if !o.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+		o.unwatchSelectedNamespace(namespace.Name)
+		return
+	}
+	o.watchNamespace(namespace.Name, stop)
+}
+
+// watchNamespace starts watching the secrets in the given namespace if it's not already being watched
+func (o *Options) watchNamespace(ns string, stop <-chan struct{}) {
+	o.namespaceLock.Lock()
+	defer o.namespaceLock.Unlock()
+
+	if o.namespaceStops[ns] != nil {
+		return
+	}
+	nsStop := make(chan struct{})
+	o.namespaceStops[ns] = nsStop
+
+	// lets only compile the masker once the initial secrets of the namespace are loaded
+	o.replaceWordMapLock.Lock()
+	o.listing[ns] = true
+	o.replaceWordMapLock.Unlock()
+
+	log.Logger().Infof("Watching for Secret resources in namespace %s", ns)
+	ctx := context.Background()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return o.KubeClient.CoreV1().Secrets(ns).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return o.KubeClient.CoreV1().Secrets(ns).Watch(ctx, options)
+		},
+	}
+	kube.SortListWatchByName(listWatch)
+	_, ctrl := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: listWatch,
+			ObjectType:    &corev1.Secret{},
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					o.onSecret(ns, obj)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					o.onSecret(ns, newObj)
+				},
+				DeleteFunc: func(obj interface{}) {
+					secret, ok := deletedObject(obj).(*corev1.Secret)
+					if !ok {
+						log.Logger().Infof("Object is not a Secret %#v", obj)
+						return
+					}
+					o.DeleteSecret(ns, secret.Name)
+				},
+			},
+			ResyncPeriod: time.Minute * 10,
+		})
+	o.synced[ns] = ctrl.HasSynced
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-nsStop:
+		}
+		close(done)
+	}()
+	go ctrl.Run(done)
+	go func() {
+		if cache.WaitForCacheSync(done, ctrl.HasSynced) {
+			o.namespaceSynced(ns)
+		}
+	}()
+}
+
+// namespaceSynced compiles the masker once the initial secrets of a namespace are loaded
+func (o *Options) namespaceSynced(ns string) {
+	o.replaceWordMapLock.Lock()
+	defer o.replaceWordMapLock.Unlock()
+	if !o.listing[ns] {
+		return
+	}
+	delete(o.listing, ns)
+	o.compileNow()
+}
+
+// unwatchSelectedNamespace stops watching a namespace which no longer matches the selector unless it is one of the static namespaces
+func (o *Options) unwatchSelectedNamespace(ns string) {
+	if stringhelpers.StringArrayIndex(o.Namespaces, ns) >= 0 {
+		return
+	}
+	o.unwatchNamespace(ns)
+}
+
+// unwatchNamespace stops watching the given namespace and removes the masks of its secrets
+func (o *Options) unwatchNamespace(ns string) {
+	o.namespaceLock.Lock()
+	nsStop := o.namespaceStops[ns]
+	if nsStop != nil {
+		close(nsStop)
+		delete(o.namespaceStops, ns)
+		delete(o.synced, ns)
+	}
+	o.namespaceLock.Unlock()
+
+	if nsStop == nil {
+		return
+	}
+	log.Logger().Infof("stopped watching for Secret resources in namespace %s", ns)
+
+	prefix := ns + "/"
+	o.replaceWordMapLock.Lock()
+	delete(o.listing, ns)
+	for k := range o.replaceWordMap {
+		if strings.HasPrefix(k, prefix) {
+			delete(o.replaceWordMap, k)
+		}
+	}
+	o.changed()
+	o.replaceWordMapLock.Unlock()
+}
+
 func (o *Options) onSecret(ns string, obj interface{}) {
 	secret, ok := obj.(*corev1.Secret)
 	if !ok {
@@ -108,16 +359,11 @@ func (o *Options) onSecret(ns string, obj interface{}) {
 	o.UpsertSecret(ns, secret)
 }
 
-// UpsertSecret upserts the secret in the replace words
+// UpsertSecret upserts the secret in the replace words, replacing any previous values of the secret
 func (o *Options) UpsertSecret(ns string, secret *corev1.Secret) {
 	if secret != nil {
 		client := &masker.Client{
-			LogFn: func(text string) {
-				if !o.loggedMessages[text] {
-					o.loggedMessages[text] = true
-					log.Logger().Info(text)
-				}
-			},
+			LogFn: o.logOnce,
 		}
 		err := client.LoadSecret(secret)
 		if err != nil {
@@ -127,21 +373,113 @@ func (o *Options) UpsertSecret(ns string, secret *corev1.Secret) {
 		fullName := fmt.Sprintf("%s/%s", ns, secret.Name)
 
 		o.replaceWordMapLock.Lock()
-		o.replaceWordMap[fullName] = client.ReplaceWords
+		if len(client.ReplaceWords) == 0 {
+			delete(o.replaceWordMap, fullName)
+		} else {
+			o.replaceWordMap[fullName] = client.ReplaceWords
+		}
+		if o.listing[ns] {
+			// the namespace is compiled once its initial secrets are loaded
+			o.dirty = true
+		} else {
+			o.compileNow()
+		}
 		o.replaceWordMapLock.Unlock()
 	}
 }
 
-// GetClient returns the masker client for all the current secrets
+// DeleteSecret removes the replace words of the given secret
+func (o *Options) DeleteSecret(ns, name string) {
+	fullName := fmt.Sprintf("%s/%s", ns, name)
+
+	o.replaceWordMapLock.Lock()
+	delete(o.replaceWordMap, fullName)
+	o.changed()
+	o.replaceWordMapLock.Unlock()
+}
+
+// GetClient returns the masker client for all the current secrets.
+//
+// The client is a shared snapshot which is replaced shortly after secrets change so it must not be modified
 func (o *Options) GetClient() *masker.Client {
-	allWords := map[string]string{}
+	client := o.client.Load()
+	if client == nil {
+		return emptyClient
+	}
+	return client
+}
 
+// Flush compiles any pending secret changes immediately rather than waiting for the debounce delay
+func (o *Options) Flush() {
 	o.replaceWordMapLock.Lock()
+	defer o.replaceWordMapLock.Unlock()
+	if o.compileTimer != nil {
+		o.compileTimer.Stop()
+		o.compileTimer = nil
+	}
+	o.compileIfDirty()
+}
+
+// compileNow compiles the masker client straight away cancelling any pending compile; the replaceWordMapLock must be held
+func (o *Options) compileNow() {
+	if o.compileTimer != nil {
+		o.compileTimer.Stop()
+		o.compileTimer = nil
+	}
+	o.dirty = false
+	o.compileClient()
+}
+
+// changed schedules a compile of the masker client after the debounce delay; the replaceWordMapLock must be held
+func (o *Options) changed() {
+	o.dirty = true
+	if o.compileTimer != nil {
+		return
+	}
+	delay := o.DebounceDelay
+	if delay <= 0 {
+		delay = DefaultDebounceDelay
+	}
+	o.compileTimer = time.AfterFunc(delay, func() {
+		o.replaceWordMapLock.Lock()
+		o.compileTimer = nil
+		o.compileIfDirty()
+		o.replaceWordMapLock.Unlock()
+	})
+}
+
+// compileIfDirty compiles the masker client if the secrets have changed; the replaceWordMapLock must be held
+func (o *Options) compileIfDirty() {
+	if o.dirty {
+		o.dirty = false
+		o.compileClient()
+	}
+}
+
+// compileClient rebuilds the masker client snapshot; the replaceWordMapLock must be held
+func (o *Options) compileClient() {
+	allWords := map[string]string{}
 	for _, words := range o.replaceWordMap {
 		for k, w := range words {
 			allWords[k] = w
 		}
 	}
-	o.replaceWordMapLock.Unlock()
-	return &masker.Client{ReplaceWords: allWords}
+	o.client.Store(masker.NewCompiledClient(allWords))
+}
+
+func (o *Options) logOnce(text string) {
+	o.loggedMessagesLock.Lock()
+	defer o.loggedMessagesLock.Unlock()
+	if !o.loggedMessages[text] {
+		o.loggedMessages[text] = true
+		log.Logger().Info(text)
+	}
+}
+
+// deletedObject returns the last known state of a deleted object
+func deletedObject(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
 }
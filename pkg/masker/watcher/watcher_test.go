@@ -4,16 +4,23 @@
 package watcher_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/masker/watcher"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestWatcherMasker(t *testing.T) {
@@ -95,6 +102,7 @@ func TestWatcherMasker(t *testing.T) {
 		}
 
 		o.UpsertSecret(tc.namespace, tc.secret)
+		o.Flush()
 
 		client := o.GetClient()
 		require.NotNil(t, client, "no client for test %s", name)
@@ -113,3 +121,296 @@ func TestWatcherMasker(t *testing.T) {
 		t.Logf("after secret %s replace words are: %s\n", name, strings.Join(client.GetReplacedWords(), ","))
 	}
 }
+
+func TestWatcherDeleteSecret(t *testing.T) {
+	ns := "jx"
+
+	o := &watcher.Options{
+		Namespaces: []string{ns},
+		KubeClient: fake.NewSimpleClientset(),
+	}
+	err := o.Validate()
+	require.NoError(t, err, "failed to validate")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "secret1",
+			Namespace: ns,
+			Annotations: map[string]string{
+				extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"}]}`,
+			},
+		},
+		Data: map[string][]byte{
+			"password": []byte("mypassword"),
+		},
+	}
+	o.UpsertSecret(ns, secret)
+	o.Flush()
+	assert.NotEmpty(t, o.GetClient().ReplaceWords["mypassword"], "should mask the password")
+
+	// rotating the value should drop the old mask
+	secret.Data["password"] = []byte("mynewpassword")
+	o.UpsertSecret(ns, secret)
+	o.Flush()
+	client := o.GetClient()
+	assert.Empty(t, client.ReplaceWords["mypassword"], "should not mask the old password")
+	assert.NotEmpty(t, client.ReplaceWords["mynewpassword"], "should mask the new password")
+
+	o.DeleteSecret(ns, secret.Name)
+	o.Flush()
+	assert.Empty(t, o.GetClient().ReplaceWords, "should not mask anything after the secret is removed")
+}
+
+func TestWatcherNamespaceSelector(t *testing.T) {
+	ctx := context.Background()
+	ns := "jx-preview"
+
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   ns,
+				Labels: map[string]string{"mask": "true"},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "secret1",
+				Namespace: ns,
+				Annotations: map[string]string{
+					extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"}]}`,
+				},
+			},
+			Data: map[string][]byte{
+				"password": []byte("mypassword"),
+			},
+		},
+	)
+
+	o := &watcher.Options{
+		NamespaceSelector: "mask=true",
+		KubeClient:        kubeClient,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- o.RunWithContext(ctx)
+	}()
+	defer func() {
+		o.Stop()
+		require.NoError(t, <-errCh, "failed to run the watcher")
+	}()
+
+	hasWord := func(word string) func() bool {
+		return func() bool {
+			return o.GetClient().ReplaceWords[word] != ""
+		}
+	}
+	require.Eventually(t, hasWord("mypassword"), 5*time.Second, 10*time.Millisecond, "should mask the secret in the selected namespace")
+
+	err := kubeClient.CoreV1().Secrets(ns).Delete(ctx, "secret1", metav1.DeleteOptions{})
+	require.NoError(t, err, "failed to delete secret")
+
+	require.Eventually(t, func() bool {
+		return !hasWord("mypassword")()
+	}, 5*time.Second, 10*time.Millisecond, "should remove the mask when the secret is deleted")
+}
+
+func newBenchmarkWatcher(b *testing.B, secretCount int) *watcher.Options {
+	ns := "jx"
+	o := &watcher.Options{
+		Namespaces: []string{ns},
+		KubeClient: fake.NewSimpleClientset(),
+	}
+	err := o.Validate()
+	require.NoError(b, err, "failed to validate")
+
+	for i := 0; i < secretCount; i++ {
+		o.UpsertSecret(ns, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("secret-%d", i),
+				Namespace: ns,
+				Annotations: map[string]string{
+					extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"},{"name":"token"}]}`,
+				},
+			},
+			Data: map[string][]byte{
+				"password": []byte(fmt.Sprintf("password-%d", i)),
+				"token":    []byte(fmt.Sprintf("token-%d", i)),
+			},
+		})
+	}
+	o.Flush()
+	return o
+}
+
+func BenchmarkWatcherGetClient(b *testing.B) {
+	o := newBenchmarkWatcher(b, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o.GetClient()
+	}
+}
+
+func BenchmarkWatcherMaskLine(b *testing.B) {
+	o := newBenchmarkWatcher(b, 500)
+	line := "some pipeline log output with password-250 and token-499 in it"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o.GetClient().Mask(line)
+	}
+}
+
+func TestWatcherNamespaceSelectorKeepsStaticNamespaces(t *testing.T) {
+	ctx := context.Background()
+	staticNS := "jx-static"
+	selectedNS := "jx-preview"
+
+	newSecret := func(ns, password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "secret1",
+				Namespace: ns,
+				Annotations: map[string]string{
+					extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"}]}`,
+				},
+			},
+			Data: map[string][]byte{
+				"password": []byte(password),
+			},
+		}
+	}
+	newNamespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"mask": "true"},
+			},
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(
+		newNamespace(staticNS),
+		newNamespace(selectedNS),
+		newSecret(staticNS, "mystaticpassword"),
+		newSecret(selectedNS, "myselectedpassword"),
+	)
+
+	o := &watcher.Options{
+		Namespaces:        []string{staticNS},
+		NamespaceSelector: "mask=true",
+		KubeClient:        kubeClient,
+	}
+	err := o.Validate()
+	require.NoError(t, err, "failed to validate")
+	assert.Greater(t, len(o.Namespaces), 1, "should add the current namespace when using a selector")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- o.RunWithContext(ctx)
+	}()
+	defer func() {
+		o.Stop()
+		require.NoError(t, <-errCh, "failed to run the watcher")
+	}()
+
+	hasWord := func(word string) func() bool {
+		return func() bool {
+			return o.GetClient().ReplaceWords[word] != ""
+		}
+	}
+	require.Eventually(t, hasWord("mystaticpassword"), 5*time.Second, 10*time.Millisecond, "should mask the secret in the static namespace")
+	require.Eventually(t, hasWord("myselectedpassword"), 5*time.Second, 10*time.Millisecond, "should mask the secret in the selected namespace")
+
+	for _, name := range []string{staticNS, selectedNS} {
+		_, err = kubeClient.CoreV1().Namespaces().Update(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}, metav1.UpdateOptions{})
+		require.NoError(t, err, "failed to remove the labels from namespace %s", name)
+	}
+
+	require.Eventually(t, func() bool {
+		return !hasWord("myselectedpassword")()
+	}, 5*time.Second, 10*time.Millisecond, "should stop masking the namespace which no longer matches the selector")
+	assert.True(t, hasWord("mystaticpassword")(), "should keep masking the static namespace")
+}
+
+func TestWatcherCompilesAfterInitialSync(t *testing.T) {
+	ns := "jx"
+	var objects []runtime.Object
+	for i := 0; i < 50; i++ {
+		objects = append(objects, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("secret-%d", i),
+				Namespace: ns,
+				Annotations: map[string]string{
+					extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"}]}`,
+				},
+			},
+			Data: map[string][]byte{
+				"password": []byte(fmt.Sprintf("password-%d", i)),
+			},
+		})
+	}
+
+	o := &watcher.Options{
+		Namespaces:    []string{ns},
+		KubeClient:    fake.NewSimpleClientset(objects...),
+		DebounceDelay: time.Hour,
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	err := o.RunWithChannel(stop)
+	require.NoError(t, err, "failed to run the watcher")
+	require.True(t, o.WaitForSync(stop), "failed to sync")
+
+	// the initial secrets are compiled when the watcher syncs rather than after the debounce delay
+	assert.Len(t, o.GetClient().ReplaceWords, len(objects), "replace words after sync")
+}
+
+func TestWatcherMasksSyncedNamespacesWhenOthersNeverSync(t *testing.T) {
+	ctx := context.Background()
+	ns := "jx"
+	forbiddenNS := "jx-forbidden"
+
+	kubeClient := fake.NewSimpleClientset(newPasswordSecret(ns, "mypassword"))
+	kubeClient.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == forbiddenNS {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "", errors.New("missing RBAC"))
+		}
+		return false, nil, nil
+	})
+
+	o := &watcher.Options{
+		Namespaces:    []string{forbiddenNS, ns},
+		KubeClient:    kubeClient,
+		DebounceDelay: time.Hour,
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	err := o.RunWithChannel(stop)
+	require.NoError(t, err, "failed to run the watcher")
+
+	hasWord := func(word string) func() bool {
+		return func() bool {
+			return o.GetClient().ReplaceWords[word] != ""
+		}
+	}
+	require.Eventually(t, hasWord("mypassword"), 5*time.Second, 10*time.Millisecond, "should mask the synced namespace")
+
+	// rotated values are masked straight away rather than after the debounce delay
+	_, err = kubeClient.CoreV1().Secrets(ns).Update(ctx, newPasswordSecret(ns, "mynewpassword"), metav1.UpdateOptions{})
+	require.NoError(t, err, "failed to update secret")
+	require.Eventually(t, hasWord("mynewpassword"), 5*time.Second, 10*time.Millisecond, "should mask the rotated value")
+}
+
+func newPasswordSecret(ns, password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "secret1",
+			Namespace: ns,
+			Annotations: map[string]string{
+				extsecrets.SchemaObjectAnnotation: `{"properties":[{"name":"password"}]}`,
+			},
+		},
+		Data: map[string][]byte{
+			"password": []byte(password),
+		},
+	}
+}
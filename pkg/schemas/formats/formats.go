@@ -0,0 +1,259 @@
+package formats
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"sigs.k8s.io/yaml"
+)
+
+// Validator validates a value returning an error describing why the value is invalid.
+// The error must never include the value so that it can be logged
+type Validator func(value string) error
+
+var (
+	lock       sync.RWMutex
+	validators = map[string]Validator{}
+)
+
+func init() {
+	Register("url", URL)
+	Register("uri", URL)
+	Register("email", Email)
+	Register("json", JSON)
+	Register("yaml", YAML)
+	Register("pem-certificate", PEMCertificate)
+	Register("pem-private-key", PEMPrivateKey)
+	Register("dockerconfigjson", DockerConfigJSON)
+	Register("htpasswd", Htpasswd)
+	Register("ssh-private-key", SSHPrivateKey)
+	Register("jwt", JWT)
+	Register("base64", Base64)
+}
+
+// Register registers a validator for the given format replacing any existing validator
+func Register(format string, validator Validator) {
+	lock.Lock()
+	defer lock.Unlock()
+	validators[format] = validator
+}
+
+// Lookup returns the validator for the given format or nil if there is no validator
+func Lookup(format string) Validator {
+	lock.RLock()
+	defer lock.RUnlock()
+	return validators[format]
+}
+
+// Names returns the sorted names of the formats with validators
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	var answer []string
+	for k := range validators {
+		answer = append(answer, k)
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+// Validate validates the value for the given format. Formats without a validator are ignored
+func Validate(format, value string) error {
+	validator := Lookup(format)
+	if validator == nil {
+		return nil
+	}
+	return validator(value)
+}
+
+// URL validates an absolute URL
+func URL(value string) error {
+	u, err := url.ParseRequestURI(value)
+	if err != nil {
+		return errors.New("is not a valid URL")
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.New("is not an absolute URL")
+	}
+	return nil
+}
+
+// Email validates a plain email address
+func Email(value string) error {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return errors.New("is not a valid email address")
+	}
+	return nil
+}
+
+// JSON validates a JSON document
+func JSON(value string) error {
+	if !json.Valid([]byte(value)) {
+		return errors.New("is not valid JSON")
+	}
+	return nil
+}
+
+// YAML validates a YAML document
+func YAML(value string) error {
+	var v interface{}
+	err := yaml.Unmarshal([]byte(value), &v)
+	if err != nil {
+		return errors.New("is not valid YAML")
+	}
+	return nil
+}
+
+// PEMCertificate validates one or more PEM encoded X.509 certificates
+func PEMCertificate(value string) error {
+	blocks := decodePEM(value)
+	if len(blocks) == 0 {
+		return errors.New("is not a PEM encoded certificate")
+	}
+	for _, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			return errors.Errorf("contains a PEM block of type %s rather than CERTIFICATE", block.Type)
+		}
+		_, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return errors.New("contains an invalid certificate")
+		}
+	}
+	return nil
+}
+
+// PEMPrivateKey validates a PEM encoded PKCS1, PKCS8 or EC private key
+func PEMPrivateKey(value string) error {
+	blocks := decodePEM(value)
+	if len(blocks) != 1 {
+		return errors.New("is not a single PEM encoded private key")
+	}
+	block := blocks[0]
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return errors.Errorf("contains a PEM block of type %s rather than a private key", block.Type)
+	}
+	if err != nil {
+		return errors.New("contains an invalid private key")
+	}
+	return nil
+}
+
+// DockerConfigJSON validates a docker config JSON document with the auths for each registry
+func DockerConfigJSON(value string) error {
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	err := json.Unmarshal([]byte(value), &config)
+	if err != nil {
+		return errors.New("is not valid JSON")
+	}
+	if config.Auths == nil {
+		return errors.New("has no auths")
+	}
+	for registry, a := range config.Auths {
+		if a.Auth == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil || !strings.Contains(string(data), ":") {
+			return errors.Errorf("has an invalid auth for registry %s", registry)
+		}
+	}
+	return nil
+}
+
+// Htpasswd validates htpasswd file content of user:hash lines
+func Htpasswd(value string) error {
+	count := 0
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" || hash == "" {
+			return errors.Errorf("line %d is not of the form user:hash", i+1)
+		}
+		count++
+	}
+	if count == 0 {
+		return errors.New("has no users")
+	}
+	return nil
+}
+
+// SSHPrivateKey validates an unencrypted SSH private key
+func SSHPrivateKey(value string) error {
+	_, err := ssh.ParseRawPrivateKey([]byte(value))
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil
+		}
+		return errors.New("is not a valid SSH private key")
+	}
+	return nil
+}
+
+// JWT validates the structure of a JSON Web Token without verifying the signature
+func JWT(value string) error {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return errors.New("is not a JWT with a header, payload and signature")
+	}
+	for i, name := range []string{"header", "payload"} {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return errors.Errorf("has a JWT %s which is not base64 URL encoded", name)
+		}
+		if !json.Valid(data) {
+			return errors.Errorf("has a JWT %s which is not JSON", name)
+		}
+	}
+	return nil
+}
+
+// Base64 validates standard base64 encoded data ignoring any whitespace
+func Base64(value string) error {
+	text := strings.Join(strings.Fields(value), "")
+	_, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return errors.New("is not valid base64")
+	}
+	return nil
+}
+
+func decodePEM(value string) []*pem.Block {
+	var answer []*pem.Block
+	rest := []byte(strings.TrimSpace(value))
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil
+		}
+		answer = append(answer, block)
+		rest = []byte(strings.TrimSpace(string(rest)))
+	}
+	return answer
+}
@@ -0,0 +1,141 @@
+package formats_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/formats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFormats(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "failed to generate RSA key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "failed to generate EC key")
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "failed to generate ed25519 key")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jenkins-x.io"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certData, err := x509.CreateCertificate(rand.Reader, template, template, &ecKey.PublicKey, ecKey)
+	require.NoError(t, err, "failed to create certificate")
+	certificate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certData}))
+
+	pkcs8Data, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err, "failed to marshal PKCS8 key")
+	pkcs8Key := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Data}))
+	pkcs1Key := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	ecData, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err, "failed to marshal EC key")
+	ecPrivateKey := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecData}))
+
+	sshBlock, err := ssh.MarshalPrivateKey(edKey, "")
+	require.NoError(t, err, "failed to marshal SSH key")
+	sshKey := string(pem.EncodeToMemory(sshBlock))
+
+	jwtPart := func(text string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(text))
+	}
+	jwt := jwtPart(`{"alg":"HS256","typ":"JWT"}`) + "." + jwtPart(`{"sub":"1234567890"}`) + "." + jwtPart("signature")
+	dockerAuth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+
+	testCases := []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			format:  "url",
+			valid:   []string{"https://github.com/jenkins-x", "http://localhost:8080/path"},
+			invalid: []string{"github.com", "/some/path", "not a url"},
+		},
+		{
+			format:  "email",
+			valid:   []string{"someone@example.com"},
+			invalid: []string{"someone", "Someone <someone@example.com>"},
+		},
+		{
+			format:  "json",
+			valid:   []string{`{"a": 1}`, `[1, 2]`},
+			invalid: []string{`{"a": `, "plain text"},
+		},
+		{
+			format:  "yaml",
+			valid:   []string{"a: 1\nb:\n- c\n", "plain text"},
+			invalid: []string{"a: [1, 2\n", "a: b: c"},
+		},
+		{
+			format:  "pem-certificate",
+			valid:   []string{certificate, certificate + certificate},
+			invalid: []string{"not a certificate", pkcs8Key, strings.Replace(certificate, "A", "B", 5)},
+		},
+		{
+			format:  "pem-private-key",
+			valid:   []string{pkcs8Key, pkcs1Key, ecPrivateKey},
+			invalid: []string{"not a key", certificate, pkcs8Key + pkcs1Key},
+		},
+		{
+			format:  "dockerconfigjson",
+			valid:   []string{`{"auths":{"ghcr.io":{"auth":"` + dockerAuth + `"}}}`, `{"auths":{}}`},
+			invalid: []string{`{}`, `{"auths":{"ghcr.io":{"auth":"!!!"}}}`, "not json"},
+		},
+		{
+			format:  "htpasswd",
+			valid:   []string{"admin:$apr1$abc$def\n# comment\nuser:{SHA}xyz\n"},
+			invalid: []string{"", "admin", "admin:\n", ":secret"},
+		},
+		{
+			format:  "ssh-private-key",
+			valid:   []string{sshKey, pkcs1Key},
+			invalid: []string{"not a key", certificate},
+		},
+		{
+			format:  "jwt",
+			valid:   []string{jwt},
+			invalid: []string{"a.b", "a.b.c", jwtPart("not json") + "." + jwtPart("{}") + ".sig"},
+		},
+		{
+			format:  "base64",
+			valid:   []string{base64.StdEncoding.EncodeToString([]byte("hello world")), "aGVs\nbG8=\n"},
+			invalid: []string{"not base64!", "abc"},
+		},
+	}
+
+	for _, tc := range testCases {
+		require.NotNil(t, formats.Lookup(tc.format), "no validator for format %s", tc.format)
+		for i, v := range tc.valid {
+			err := formats.Validate(tc.format, v)
+			assert.NoError(t, err, "format %s valid value %d", tc.format, i)
+		}
+		for i, v := range tc.invalid {
+			err := formats.Validate(tc.format, v)
+			if assert.Error(t, err, "format %s invalid value %d", tc.format, i) && len(v) > 3 {
+				assert.NotContains(t, err.Error(), v, "error for format %s should not contain the value", tc.format)
+			}
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	assert.Nil(t, formats.Lookup("cheese"), "should have no validator")
+	assert.NoError(t, formats.Validate("cheese", "anything"), "unknown formats should be ignored")
+	assert.Contains(t, formats.Names(), "pem-certificate", "names")
+}
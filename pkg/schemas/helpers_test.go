@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/testschemas"
 	"github.com/stretchr/testify/assert"
@@ -34,3 +35,63 @@ func TestValidateMissingName(t *testing.T) {
 		t.Logf("loaded s %#v", s.Spec)
 	}
 }
+
+func TestValidatePropertyValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		property *v1alpha1.Property
+		value    string
+		expected []string
+	}{
+		{
+			name:     "no property",
+			value:    "anything",
+			expected: nil,
+		},
+		{
+			name:     "valid",
+			property: &v1alpha1.Property{Name: "token", MinLength: 4, MaxLength: 8, Pattern: "^[a-z]+$"},
+			value:    "abcdef",
+			expected: nil,
+		},
+		{
+			name:     "too short",
+			property: &v1alpha1.Property{Name: "token", MinLength: 4},
+			value:    "abc",
+			expected: []string{"is shorter than the minimum length of 4"},
+		},
+		{
+			name:     "too long",
+			property: &v1alpha1.Property{Name: "token", MaxLength: 2},
+			value:    "abc",
+			expected: []string{"is longer than the maximum length of 2"},
+		},
+		{
+			name:     "pattern",
+			property: &v1alpha1.Property{Name: "token", Pattern: "^[0-9]+$"},
+			value:    "abc",
+			expected: []string{"does not match the pattern ^[0-9]+$"},
+		},
+		{
+			name:     "valid url",
+			property: &v1alpha1.Property{Name: "url", Format: "url"},
+			value:    "https://github.com/jenkins-x",
+			expected: nil,
+		},
+		{
+			name:     "invalid url",
+			property: &v1alpha1.Property{Name: "url", Format: "url"},
+			value:    "github.com",
+			expected: []string{"is not a valid URL for format url"},
+		},
+	}
+
+	for _, tc := range testCases {
+		messages, err := schemas.ValidatePropertyValue(tc.property, tc.value)
+		require.NoError(t, err, "failed to validate %s", tc.name)
+		assert.Equal(t, tc.expected, messages, "messages for %s", tc.name)
+	}
+
+	_, err := schemas.ValidatePropertyValue(&v1alpha1.Property{Name: "token", Pattern: "["}, "abc")
+	require.Error(t, err, "should fail for an invalid pattern")
+}
@@ -0,0 +1,414 @@
+package requires
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// PropertiesKey the root variable used to refer to the values of the other properties in the secret
+// e.g. `properties.username != ""`
+const PropertiesKey = "properties"
+
+// Expression a parsed requires expression such as `cluster.provider == "gke" && !webhook.enabled`
+//
+// Expressions support the `||`, `&&` and `!` boolean operators, the `==`, `!=`, `<`, `<=`, `>` and `>=` comparisons,
+// parentheses, quoted strings, numbers, `true`, `false` and dotted paths into the variables.
+// A path on its own is true if its value is not blank, false, zero or missing.
+type Expression struct {
+	text  string
+	root  node
+	paths []string
+}
+
+// Parse parses the expression text
+func Parse(text string) (*Expression, error) {
+	p := &parser{text: text}
+	err := p.tokenize()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse requires expression %s", text)
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse requires expression %s", text)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.Errorf("failed to parse requires expression %s: unexpected %s", text, p.tokens[p.pos].text)
+	}
+	return &Expression{text: text, root: root, paths: p.paths}, nil
+}
+
+// Evaluate parses and evaluates the expression text returning true if the expression is blank
+func Evaluate(text string, variables map[string]interface{}) (bool, error) {
+	if strings.TrimSpace(text) == "" {
+		return true, nil
+	}
+	expression, err := Parse(text)
+	if err != nil {
+		return false, err
+	}
+	return expression.Evaluate(variables), nil
+}
+
+// Evaluate evaluates the expression with the given variables
+func (e *Expression) Evaluate(variables map[string]interface{}) bool {
+	return truthy(e.root.eval(variables))
+}
+
+// Paths returns the variable paths used in the expression
+func (e *Expression) Paths() []string {
+	return e.paths
+}
+
+// String returns the expression text
+func (e *Expression) String() string {
+	return e.text
+}
+
+type node interface {
+	eval(variables map[string]interface{}) interface{}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+type path struct {
+	names []string
+}
+
+func (n *path) eval(variables map[string]interface{}) interface{} {
+	var value interface{} = variables
+	for _, name := range n.names {
+		value = lookup(value, name)
+		if value == nil {
+			return nil
+		}
+	}
+	return value
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(variables map[string]interface{}) interface{} {
+	return !truthy(n.operand.eval(variables))
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n *binary) eval(variables map[string]interface{}) interface{} {
+	switch n.op {
+	case "||":
+		return truthy(n.left.eval(variables)) || truthy(n.right.eval(variables))
+	case "&&":
+		return truthy(n.left.eval(variables)) && truthy(n.right.eval(variables))
+	}
+	return compare(n.op, n.left.eval(variables), n.right.eval(variables))
+}
+
+// lookup returns the named value of a map or struct field
+func lookup(value interface{}, name string) interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m[name]
+	case map[string]string:
+		v, ok := m[name]
+		if !ok {
+			return nil
+		}
+		return v
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		item := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if item.IsValid() {
+			return item.Interface()
+		}
+	}
+	return nil
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != "" && v != "false"
+	}
+	if f, ok := toFloat(value); ok {
+		return f != 0
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Ptr, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return true
+}
+
+func compare(op string, left, right interface{}) bool {
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if lok && rok {
+		switch op {
+		case "==":
+			return lf == rf
+		case "!=":
+			return lf != rf
+		case "<":
+			return lf < rf
+		case "<=":
+			return lf <= rf
+		case ">":
+			return lf > rf
+		case ">=":
+			return lf >= rf
+		}
+		return false
+	}
+	ls := toString(left)
+	rs := toString(right)
+	switch op {
+	case "==":
+		return ls == rs
+	case "!=":
+		return ls != rs
+	case "<":
+		return ls < rs
+	case "<=":
+		return ls <= rs
+	case ">":
+		return ls > rs
+	case ">=":
+		return ls >= rs
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+type token struct {
+	kind string
+	text string
+}
+
+const (
+	tokenOperator = "operator"
+	tokenString   = "string"
+	tokenNumber   = "number"
+	tokenIdent    = "identifier"
+)
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+	paths  []string
+}
+
+func (p *parser) tokenize() error {
+	runes := []rune(p.text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			buf := strings.Builder{}
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				buf.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return errors.Errorf("unterminated string at position %d", i)
+			}
+			p.tokens = append(p.tokens, token{kind: tokenString, text: buf.String()})
+			i = j + 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenNumber, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '-' || runes[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenIdent, text: string(runes[i:j])})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return errors.Errorf("unexpected character %q at position %d", r, i)
+			}
+			p.tokens = append(p.tokens, token{kind: tokenOperator, text: op})
+			i += len(op)
+		}
+	}
+	return nil
+}
+
+func (p *parser) peekOperator(ops ...string) string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	if t.kind != tokenOperator {
+		return ""
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("||") != "" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("&&") != "" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peekOperator("!") != "" {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peekOperator("==", "!=", "<=", ">=", "<", ">")
+	if op == "" {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenString:
+		return &literal{value: t.text}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid number %s", t.text)
+		}
+		return &literal{value: f}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		}
+		p.paths = append(p.paths, t.text)
+		return &path{names: strings.Split(t.text, ".")}, nil
+	}
+	if t.text == "(" {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOperator(")") == "" {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, errors.Errorf("unexpected %s", t.text)
+}
@@ -0,0 +1,74 @@
+package requires_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/requires"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	variables := map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"provider":  "gke",
+			"projectID": "my-project",
+		},
+		"webhook":    "lighthouse",
+		"ingress":    map[string]interface{}{"tls": map[string]interface{}{"enabled": true}},
+		"repository": "nexus",
+		"replicas":   float64(3),
+		"properties": map[string]string{
+			"username": "admin",
+			"password": "",
+		},
+	}
+
+	testCases := []struct {
+		expression string
+		expected   bool
+	}{
+		{expression: "", expected: true},
+		{expression: `cluster.provider == "gke"`, expected: true},
+		{expression: `cluster.provider == 'eks'`, expected: false},
+		{expression: `cluster.provider != "eks"`, expected: true},
+		{expression: `cluster.provider == "gke" && webhook == "lighthouse"`, expected: true},
+		{expression: `cluster.provider == "eks" || webhook == "lighthouse"`, expected: true},
+		{expression: `cluster.provider == "eks" || (webhook == "lighthouse" && repository == "bucketrepo")`, expected: false},
+		{expression: `ingress.tls.enabled`, expected: true},
+		{expression: `!ingress.tls.enabled`, expected: false},
+		{expression: `ingress.tls.enabled == true`, expected: true},
+		{expression: `cluster.missing`, expected: false},
+		{expression: `!cluster.missing.value`, expected: true},
+		{expression: `replicas > 2`, expected: true},
+		{expression: `replicas <= 2`, expected: false},
+		{expression: `properties.username`, expected: true},
+		{expression: `properties.password`, expected: false},
+		{expression: `properties.username == "admin" && !properties.password`, expected: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := requires.Evaluate(tc.expression, variables)
+		require.NoError(t, err, "failed to evaluate %s", tc.expression)
+		assert.Equal(t, tc.expected, got, "for expression %s", tc.expression)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, text := range []string{
+		`cluster.provider ==`,
+		`(cluster.provider == "gke"`,
+		`cluster.provider == "gke`,
+		`cluster.provider = "gke"`,
+		`cluster.provider "gke"`,
+	} {
+		_, err := requires.Parse(text)
+		assert.Error(t, err, "should have failed to parse %s", text)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	expression, err := requires.Parse(`cluster.provider == "gke" && !properties.token`)
+	require.NoError(t, err, "failed to parse")
+	assert.Equal(t, []string{"cluster.provider", "properties.token"}, expression.Paths())
+}
@@ -0,0 +1,44 @@
+package schemas
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/apis/schema/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/schemas/formats"
+	"github.com/pkg/errors"
+)
+
+// ValidatePropertyValue validates a value against the Pattern, MinLength, MaxLength and Format of the property.
+// Returns a description of each violation found. The descriptions never include the value so that they can be logged.
+// Formats without a validator in the formats registry are ignored
+func ValidatePropertyValue(property *v1alpha1.Property, value string) ([]string, error) {
+	if property == nil {
+		return nil, nil
+	}
+	var answer []string
+	length := utf8.RuneCountInString(value)
+	if property.MinLength > 0 && length < property.MinLength {
+		answer = append(answer, fmt.Sprintf("is shorter than the minimum length of %d", property.MinLength))
+	}
+	if property.MaxLength > 0 && length > property.MaxLength {
+		answer = append(answer, fmt.Sprintf("is longer than the maximum length of %d", property.MaxLength))
+	}
+	if property.Pattern != "" {
+		r, err := regexp.Compile(property.Pattern)
+		if err != nil {
+			return answer, errors.Wrapf(err, "failed to parse pattern %s for property %s", property.Pattern, property.Name)
+		}
+		if !r.MatchString(value) {
+			answer = append(answer, fmt.Sprintf("does not match the pattern %s", property.Pattern))
+		}
+	}
+	if property.Format != "" {
+		err := formats.Validate(property.Format, value)
+		if err != nil {
+			answer = append(answer, fmt.Sprintf("%s for format %s", err.Error(), property.Format))
+		}
+	}
+	return answer, nil
+}
@@ -0,0 +1,144 @@
+package vaultstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/iam/vaultiam"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// versionedStore a vault secret store which uses the check-and-set of the KV version 2 secrets engine
+// so that merged writes do not overwrite properties written concurrently by other tools
+type versionedStore struct {
+	secretstore.Interface
+	client *api.Client
+}
+
+var _ editor.VersionedStore = &versionedStore{}
+
+// NewVersionedStore wraps the vault secret store so that it implements editor.VersionedStore
+func NewVersionedStore(store secretstore.Interface, client *api.Client) secretstore.Interface {
+	return &versionedStore{Interface: store, client: client}
+}
+
+// NewClient creates a vault client using the same environment and credentials as the vault secret store
+func NewClient(kubeClient kubernetes.Interface, isExternalVault string) (*api.Client, error) {
+	client, err := api.NewClient(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vault client")
+	}
+	var creds vaultiam.VaultCreds
+	if isExternalVault == "true" {
+		creds, err = vaultiam.NewExternalSecretCreds(client, kubeClient)
+	} else {
+		creds, err = vaultiam.NewEnvironmentCreds()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get vault credentials")
+	}
+	client.SetToken(creds.Token)
+	return client, nil
+}
+
+// GetSecretVersion returns all the properties of the secret and its version which is blank if the secret does not exist.
+// Returns editor.ErrVersionsNotSupported if the secret is not in a KV version 2 secrets engine
+func (v *versionedStore) GetSecretVersion(location, secretName string) (map[string]string, string, error) {
+	err := v.client.SetAddress(location)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to set the vault address %s", location)
+	}
+	if !v.isKVVersion2(secretName) {
+		return nil, "", editor.ErrVersionsNotSupported
+	}
+	secret, err := v.client.Logical().Read(secretName)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read secret %s from vault %s", secretName, location)
+	}
+	if secret == nil {
+		return nil, "", nil
+	}
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	if metadata == nil {
+		return nil, "", editor.ErrVersionsNotSupported
+	}
+	version := fmt.Sprint(metadata["version"])
+
+	answer := map[string]string{}
+	data, _ := secret.Data["data"].(map[string]interface{})
+	for k, value := range data {
+		text, ok := value.(string)
+		if !ok {
+			return nil, "", errors.Errorf("property %s of secret %s in vault %s is not a string", k, secretName, location)
+		}
+		answer[k] = text
+	}
+	return answer, version, nil
+}
+
+// SetSecretVersion writes the secret if it is still at the given version otherwise returns editor.ErrVersionConflict
+func (v *versionedStore) SetSecretVersion(location, secretName string, secretValue *secretstore.SecretValue, version string) error {
+	cas := 0
+	if version != "" {
+		var err error
+		cas, err = strconv.Atoi(version)
+		if err != nil {
+			return errors.Wrapf(err, "invalid version %s of secret %s", version, secretName)
+		}
+	}
+	err := v.client.SetAddress(location)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set the vault address %s", location)
+	}
+	data := map[string]interface{}{}
+	for k, value := range secretValue.PropertyValues {
+		data[k] = value
+	}
+	_, err = v.client.Logical().Write(secretName, map[string]interface{}{
+		"data": data,
+		"options": map[string]interface{}{
+			"cas": cas,
+		},
+	})
+	if err != nil {
+		if isCheckAndSetError(err) {
+			return editor.ErrVersionConflict
+		}
+		return errors.Wrapf(err, "failed to write secret %s to vault %s", secretName, location)
+	}
+	return nil
+}
+
+// isKVVersion2 returns true if the secret is in a KV version 2 secrets engine using the same mount lookup as the vault CLI.
+// If the mount cannot be looked up such as on older vault servers we assume version 1 which does not support check-and-set
+func (v *versionedStore) isKVVersion2(secretName string) bool {
+	mount, err := v.client.Logical().Read("sys/internal/ui/mounts/" + secretName)
+	if err != nil || mount == nil {
+		if err != nil {
+			log.Logger().Debugf("failed to look up the vault mount of secret %s: %s", secretName, err.Error())
+		}
+		return false
+	}
+	options, _ := mount.Data["options"].(map[string]interface{})
+	return options != nil && fmt.Sprint(options["version"]) == "2"
+}
+
+// isCheckAndSetError returns true if the write failed as the secret is no longer at the expected version
+func isCheckAndSetError(err error) bool {
+	var responseError *api.ResponseError
+	if !errors.As(err, &responseError) {
+		return false
+	}
+	for _, message := range responseError.Errors {
+		if strings.Contains(message, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
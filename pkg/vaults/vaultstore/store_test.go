@@ -0,0 +1,193 @@
+package vaultstore_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/extsecrets/editor"
+	"github.com/jenkins-x-plugins/jx-secret/pkg/vaults/vaultstore"
+	"github.com/jenkins-x-plugins/secretfacade/pkg/secretstore"
+	secretstorefake "github.com/jenkins-x-plugins/secretfacade/testing/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKV a fake vault KV secrets engine which only stores secrets for version 2
+type fakeKV struct {
+	lock      sync.Mutex
+	data      map[string]map[string]interface{}
+	versions  map[string]int
+	kvVersion int
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path := r.URL.Path[len("/v1/"):]
+	if strings.HasPrefix(path, "sys/internal/ui/mounts/") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"path":    "secret/",
+				"type":    "kv",
+				"options": map[string]interface{}{"version": strconv.Itoa(f.kvVersion)},
+			},
+		})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if f.versions[path] == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     f.data[path],
+				"metadata": map[string]interface{}{"version": f.versions[path]},
+			},
+		})
+
+	case http.MethodPut, http.MethodPost:
+		body := struct {
+			Data    map[string]interface{} `json:"data"`
+			Options map[string]int         `json:"options"`
+		}{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{err.Error()}})
+			return
+		}
+		cas, ok := body.Options["cas"]
+		if ok && cas != f.versions[path] {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": []string{"check-and-set parameter did not match the current version"}})
+			return
+		}
+		f.data[path] = body.Data
+		f.versions[path]++
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": f.versions[path]}})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newVersionedStore(t *testing.T) (*fakeKV, secretstore.Interface, string) {
+	kv, store, _, location := newVersionedStoreWithFake(t, 2)
+	return kv, store, location
+}
+
+func newVersionedStoreWithFake(t *testing.T, kvVersion int) (*fakeKV, secretstore.Interface, *secretstorefake.SecretStore, string) {
+	kv := &fakeKV{
+		data:      map[string]map[string]interface{}{},
+		versions:  map[string]int{},
+		kvVersion: kvVersion,
+	}
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	require.NoError(t, err, "failed to create vault client")
+	client.SetToken("dummy")
+
+	fakeFactory := &secretstorefake.SecretManagerFactory{}
+	store, err := fakeFactory.NewSecretManager(secretstore.SecretStoreTypeVault)
+	require.NoError(t, err)
+	return kv, vaultstore.NewVersionedStore(store, client), fakeFactory.GetSecretStore(), server.URL
+}
+
+func TestVersionedStoreKeepsPropertiesOfOtherTools(t *testing.T) {
+	key := "secret/data/jx/registry"
+	kv, store, location := newVersionedStore(t)
+	kv.data[key] = map[string]interface{}{"username": "admin", "token": "written-by-another-tool"}
+	kv.versions[key] = 3
+
+	err := newMergeWrite(store, location, key, nil).Write()
+	require.NoError(t, err, "failed to write")
+
+	assert.Equal(t, map[string]interface{}{
+		"username": "admin",
+		"password": "new-password",
+		"token":    "written-by-another-tool",
+	}, kv.data[key], "properties")
+	assert.Equal(t, 4, kv.versions[key], "version")
+}
+
+func TestVersionedStoreCheckAndSet(t *testing.T) {
+	key := "secret/data/jx/registry"
+	kv, store, location := newVersionedStore(t)
+	vs, ok := store.(editor.VersionedStore)
+	require.True(t, ok, "should implement editor.VersionedStore")
+
+	current, version, err := vs.GetSecretVersion(location, key)
+	require.NoError(t, err, "failed to read missing secret")
+	assert.Empty(t, current, "properties of missing secret")
+	assert.Empty(t, version, "version of missing secret")
+
+	sv := &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin"}}
+	err = vs.SetSecretVersion(location, key, sv, version)
+	require.NoError(t, err, "failed to create secret")
+
+	current, version, err = vs.GetSecretVersion(location, key)
+	require.NoError(t, err, "failed to read secret")
+	assert.Equal(t, map[string]string{"username": "admin"}, current, "properties")
+	assert.Equal(t, "1", version, "version")
+
+	// lets simulate another tool writing the secret after we read it
+	kv.versions[key]++
+
+	err = vs.SetSecretVersion(location, key, sv, version)
+	require.Error(t, err, "should fail to write a stale version")
+	assert.ErrorIs(t, err, editor.ErrVersionConflict, "error")
+}
+
+func TestVersionedStoreKVVersion1(t *testing.T) {
+	key := "secret/jx/registry"
+	kv, store, fakeStore, location := newVersionedStoreWithFake(t, 1)
+	err := fakeStore.SetSecret(location, key, &secretstore.SecretValue{PropertyValues: map[string]string{"username": "admin"}})
+	require.NoError(t, err)
+
+	vs, ok := store.(editor.VersionedStore)
+	require.True(t, ok, "should implement editor.VersionedStore")
+	_, _, err = vs.GetSecretVersion(location, key)
+	assert.ErrorIs(t, err, editor.ErrVersionsNotSupported, "error")
+
+	// lets fall back to merging the properties without check-and-set
+	err = newMergeWrite(store, location, key, []string{"username", "password"}).Write()
+	require.NoError(t, err, "failed to write")
+
+	fakeStore.AssertValueEquals(t, location, key, "username", "admin")
+	fakeStore.AssertValueEquals(t, location, key, "password", "new-password")
+	assert.Empty(t, kv.versions, "should not write with check-and-set")
+}
+
+func newMergeWrite(store secretstore.Interface, location, key string, properties []string) *editor.MergeWrite {
+	return &editor.MergeWrite{
+		Store:      store,
+		Location:   location,
+		Key:        key,
+		Properties: properties,
+		Changed:    []editor.PropertyValue{{Property: "password", Value: "new-password"}},
+		CreateSecretValue: func(values []editor.PropertyValue) secretstore.SecretValue {
+			m := map[string]string{}
+			for _, p := range values {
+				m[p.PropertyName()] = p.Value
+			}
+			return secretstore.SecretValue{PropertyValues: m}
+		},
+	}
+}